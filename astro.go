@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var astroBuiltins = []builtin{
+	{"deg", deg, "deg(x)", "x radians in degrees"},
+	{"rad", rad, "rad(x)", "x degrees in radians"},
+	{"hms", hms, "hms(x[, places])", "x radians as hh:mm:ss.ss, with places decimals of seconds"},
+	{"dms", dms, "dms(x[, places])", "x radians as +dd:mm:ss.s, with places decimals of seconds"},
+	{"parsehms", parsehms, "parsehms(s)", "radians of s in hours, minutes and seconds"},
+	{"parsedms", parsedms, "parsedms(s)", "radians of s in degrees, minutes and seconds"},
+	{"azel", azel, "azel(ra, dec, lat, lon, t)", "azimuth and elevation in radians of ra and dec of date at east longitude lon and latitude lat at time t"},
+	{"lst", lst, "lst(t, lon)", "local mean sidereal time in radians at time t and east longitude lon"},
+}
+
+// Angles are in radians, as in shared memory
+
+var (
+	deg = mathFunc(func(x float64) float64 { return x * 180 / math.Pi })
+	rad = mathFunc(func(x float64) float64 { return x * math.Pi / 180 })
+)
+
+// sexagesimal formats x as units:mm:ss with places decimals of seconds.
+// If wrap is positive, x is taken modulo wrap units.
+func sexagesimal(x float64, places int, wrap int64, signed bool) string {
+	if places < 0 || places > 9 {
+		panic(fmt.Errorf("bad number of places %d", places))
+	}
+	sign := "+"
+	if x < 0 && wrap == 0 {
+		sign, x = "-", -x
+	}
+
+	scale := int64(math.Pow(10, float64(places)))
+	total := int64(math.Round(x * 3600 * float64(scale)))
+	if wrap > 0 {
+		n := wrap * 3600 * scale
+		total = (total%n + n) % n
+	}
+	frac := total % scale
+	secs := total / scale
+
+	s := fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	if places > 0 {
+		s += fmt.Sprintf(".%0*d", places, frac)
+	}
+	if signed {
+		s = sign + s
+	}
+	return s
+}
+
+func placesArg(places []int, def int) int {
+	switch len(places) {
+	case 0:
+		return def
+	case 1:
+		return places[0]
+	}
+	panic("too many arguments")
+}
+
+func hms(x interface{}, places ...int) interface{} {
+	p := placesArg(places, 2)
+	return numberwise(reflect.ValueOf(x), func(r float64) interface{} {
+		return sexagesimal(r*12/math.Pi, p, 24, false)
+	})
+}
+
+func dms(x interface{}, places ...int) interface{} {
+	p := placesArg(places, 1)
+	return numberwise(reflect.ValueOf(x), func(r float64) interface{} {
+		return sexagesimal(r*180/math.Pi, p, 0, true)
+	})
+}
+
+// parseSexagesimal parses s as units, minutes and seconds, separated by
+// colons, spaces or unit letters, or run together as in FS source commands,
+// eg 123456.7 for 12:34:56.7
+func parseSexagesimal(s string) float64 {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return strings.ContainsRune(" \t:hmsd°'\"", r)
+	})
+	if len(fields) == 1 {
+		whole := fields[0]
+		if i := strings.IndexByte(whole, '.'); i != -1 {
+			whole = whole[:i]
+		}
+		if n := len(whole); n >= 5 {
+			fields = []string{fields[0][:n-4], fields[0][n-4 : n-2], fields[0][n-2:]}
+		}
+	}
+	if len(fields) == 0 || len(fields) > 3 {
+		panic(fmt.Errorf("bad angle %q", s))
+	}
+
+	x := 0.0
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			panic(fmt.Errorf("bad angle %q", s))
+		}
+		x += v / math.Pow(60, float64(i))
+	}
+	if neg {
+		x = -x
+	}
+	return x
+}
+
+func parsehms(s interface{}) interface{} {
+	return stringwise(reflect.ValueOf(s), func(s string) interface{} {
+		return parseSexagesimal(s) * math.Pi / 12
+	})
+}
+
+func parsedms(s interface{}) interface{} {
+	return stringwise(reflect.ValueOf(s), func(s string) interface{} {
+		return parseSexagesimal(s) * math.Pi / 180
+	})
+}
+
+// gmst is the Greenwich mean sidereal time in radians at t
+func gmst(t time.Time) float64 {
+	d := float64(t.UnixNano())/1e9/86400 + 2440587.5 - 2451545
+	c := d / 36525
+	g := 280.46061837 + 360.98564736629*d + 0.000387933*c*c - c*c*c/38710000
+	return g * math.Pi / 180
+}
+
+func wrap2pi(x float64) float64 {
+	x = math.Mod(x, 2*math.Pi)
+	if x < 0 {
+		x += 2 * math.Pi
+	}
+	if x >= 2*math.Pi {
+		// rounding of tiny negatives
+		x = 0
+	}
+	return x
+}
+
+func lst(t interface{}, lon interface{}) float64 {
+	tm := toTime(reflect.ValueOf(t), time.Now())
+	return wrap2pi(gmst(tm) + number(reflect.ValueOf(lon)))
+}
+
+// An azEl is a horizontal position in radians
+type azEl struct {
+	Az float64 `json:"az"`
+	El float64 `json:"el"`
+}
+
+func azel(ra, dec, lat, lon, t interface{}) azEl {
+	r := number(reflect.ValueOf(ra))
+	d := number(reflect.ValueOf(dec))
+	phi := number(reflect.ValueOf(lat))
+	h := lst(t, lon) - r
+
+	el := math.Asin(math.Sin(d)*math.Sin(phi) + math.Cos(d)*math.Cos(phi)*math.Cos(h))
+	az := math.Atan2(-math.Cos(d)*math.Sin(h), math.Sin(d)*math.Cos(phi)-math.Cos(d)*math.Sin(phi)*math.Cos(h))
+	return azEl{wrap2pi(az), el}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestAngles(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `round(deg(rad(90)), 9)`, want: "90"},
+		{src: `round(deg(parsehms("06:00:00")), 9)`, want: "90"},
+		{src: `hms(parsehms("12:34:56.78"))`, want: `"12:34:56.78"`},
+		{src: `hms(parsehms("12h34m56.78s"), 0)`, want: `"12:34:57"`},
+		{src: `hms(parsehms("041957.90"))`, want: `"04:19:57.90"`},
+		{src: `hms(parsehms("23:59:59.999"))`, want: `"00:00:00.00"`},
+		{src: `hms(rad(-15))`, want: `"23:00:00.00"`},
+		{src: `dms(rad(-12.5))`, want: `"-12:30:00.0"`},
+		{src: `dms(parsedms("+41 30 42.1"), 2)`, want: `"+41:30:42.10"`},
+		{src: `dms(parsedms("-413042.1"))`, want: `"-41:30:42.1"`},
+		{src: `round(deg(parsedms("12d30m")), 9)`, want: "12.5"},
+		{src: `hms(0, 10)`, err: "bad number of places 10"},
+		{src: `hms(0, 1, 2)`, err: "too many arguments"},
+		{src: `parsehms("x")`, err: `bad angle "x"`},
+		{src: `parsedms("1:2:3:4")`, err: `bad angle "1:2:3:4"`},
+	})
+}
+
+func TestSky(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		// GMST at J2000.0
+		{src: `round(deg(lst("2000-01-01T12:00:00Z", 0)), 6)`, want: "280.460618"},
+		{src: `round(deg(lst("2000-01-01T12:00:00Z", rad(-90))), 6)`, want: "190.460618"},
+		{src: `round(deg(azel(lst("2026.289.12:00:00", 1), rad(45), rad(45), 1, "2026.289.12:00:00").el), 6)`, want: "90"},
+		{src: `round(deg(azel(0, rad(90), rad(30), 0, "2026.289.12:00:00").el), 6)`, want: "30"},
+		{src: `round(deg(azel(0, rad(90), rad(30), 0, "2026.289.12:00:00").az), 6)`, want: "0"},
+		{src: `round(deg(azel(lst("2026.289.12:00:00", 0), rad(-30), 0, 0, "2026.289.12:00:00").az), 6)`, want: "180"},
+		{src: `round(deg(azel(lst("2026.289.12:00:00", 0), rad(-30), 0, 0, "2026.289.12:00:00").el), 6)`, want: "60"},
+	})
+}
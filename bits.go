@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"go/constant"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var bitBuiltins = []builtin{
+	{"bit", bit, "bit(x, n)", "whether bit n of x is set"},
+	{"bits", bitRange, "bits(x, lo, hi)", "bits lo to hi of x, inclusive, shifted down"},
+	{"hex", hex, "hex(x)", "x in hexadecimal, in two's complement if it is negative"},
+	{"bin", bin, "bin(x[, width])", "x in binary, padded to width digits, by default the size of its type"},
+	{"oct", oct, "oct(x)", "x in octal, in two's complement if it is negative"},
+	{"flags", flags, "flags(x, names...)", "the names of the bits set in x, for bits 0 up"},
+}
+
+// hexInts is set to show integers in hex
+var hexInts bool
+
+// word returns the bits of the integer v, and the size of its type. Signed
+// values are in two's complement.
+func word(v reflect.Value) (uint64, int) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			panic("nil is not an integer")
+		}
+		v = v.Elem()
+	}
+	if c, ok := v.Interface().(constant.Value); ok {
+		if c.Kind() == constant.Int {
+			if i, exact := constant.Int64Val(c); exact {
+				return uint64(i), 64
+			}
+			if u, exact := constant.Uint64Val(c); exact {
+				return u, 64
+			}
+		}
+		panic(fmt.Errorf("%s is not a 64 bit integer", c))
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Type().Bits()
+		return uint64(v.Int()) & (^uint64(0) >> (64 - n)), n
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), v.Type().Bits()
+	}
+	panic(fmt.Errorf("%s is not an integer", v.Type()))
+}
+
+// wordwise applies f to the integer x, or each integer in x
+func wordwise(x reflect.Value, f func(w uint64, size int) interface{}) interface{} {
+	elems, ok := elements(x)
+	if !ok {
+		return f(word(x))
+	}
+	out := make([]interface{}, len(elems))
+	for i, e := range elems {
+		out[i] = wordwise(e, f)
+	}
+	return out
+}
+
+// bitIndex panics unless n is a bit of a word of size bits
+func bitIndex(n, size int) {
+	if n < 0 || n >= size {
+		panic(fmt.Errorf("bit %d out of range for %d bit integer", n, size))
+	}
+}
+
+func bit(x interface{}, n int) interface{} {
+	return wordwise(reflect.ValueOf(x), func(w uint64, size int) interface{} {
+		bitIndex(n, size)
+		return w&(1<<uint(n)) != 0
+	})
+}
+
+func bitRange(x interface{}, lo, hi int) interface{} {
+	if hi < lo {
+		panic("bits: hi is less than lo")
+	}
+	return wordwise(reflect.ValueOf(x), func(w uint64, size int) interface{} {
+		bitIndex(lo, size)
+		bitIndex(hi, size)
+		return w >> uint(lo) & (^uint64(0) >> uint(63-(hi-lo)))
+	})
+}
+
+func hex(x interface{}) interface{} {
+	return wordwise(reflect.ValueOf(x), func(w uint64, size int) interface{} {
+		return "0x" + strconv.FormatUint(w, 16)
+	})
+}
+
+func oct(x interface{}) interface{} {
+	return wordwise(reflect.ValueOf(x), func(w uint64, size int) interface{} {
+		return "0o" + strconv.FormatUint(w, 8)
+	})
+}
+
+func bin(x interface{}, width ...int) interface{} {
+	if len(width) > 1 {
+		panic("bin takes at most two arguments")
+	}
+	return wordwise(reflect.ValueOf(x), func(w uint64, size int) interface{} {
+		if len(width) == 1 {
+			size = width[0]
+		}
+		s := strconv.FormatUint(w, 2)
+		if pad := size - len(s); pad > 0 {
+			s = strings.Repeat("0", pad) + s
+		}
+		return "0b" + s
+	})
+}
+
+func flags(x interface{}, names ...string) interface{} {
+	return wordwise(reflect.ValueOf(x), func(w uint64, size int) interface{} {
+		set := []string{}
+		for w != 0 {
+			n := bits.TrailingZeros64(w)
+			w &^= 1 << uint(n)
+			switch {
+			case n >= len(names):
+				set = append(set, "bit"+strconv.Itoa(n))
+			case names[n] != "":
+				set = append(set, names[n])
+			}
+		}
+		return set
+	})
+}
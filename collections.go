@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"reflect"
+	"sort"
+)
+
+var collectionBuiltins = []builtin{
+	{"map", mapOf, "map(xs, f)", "f of each element of xs"},
+	{"filter", filter, "filter(xs, f)", "the elements of xs for which f is true"},
+	{"reduce", reduce, "reduce(xs, f, init)", "f(acc, x) of each element x of xs in turn, starting with acc = init"},
+	{"sortby", sortby, "sortby(xs, f)", "the elements of xs in order of f of each"},
+	{"groupby", groupby, "groupby(xs, f)", "the elements of xs, by f of each"},
+	{"uniq", uniq, "uniq(xs)", "the elements of xs without repeats"},
+	{"count", count, "count(xs[, f])", "number of elements of xs, or those for which f is true"},
+	{"enumerate", enumerate, "enumerate(xs)", "the index and value of each element of xs"},
+	{"zip", zip, "zip(xs...)", "lists of the i'th elements of each of xs, as long as the shortest"},
+	{"compact", compact, "compact(xs)", "the elements of xs that aren't zero"},
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// Collections are arrays and slices of any type. Results keep the element
+// type of the collection, or of the values of f, where they can.
+
+// collection returns the array or slice xs, panicking if it is neither
+func collection(xs interface{}) reflect.Value {
+	v := deref(reflect.ValueOf(xs))
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+		panic(fmt.Errorf("%v is not an array or slice", reflect.TypeOf(xs)))
+	}
+	return v
+}
+
+// function returns the function f, panicking if it isn't one
+func function(f interface{}) reflect.Value {
+	v := deref(reflect.ValueOf(f))
+	if v.Kind() != reflect.Func {
+		panic(fmt.Errorf("%v is not a function", reflect.TypeOf(f)))
+	}
+	return v
+}
+
+// sliceOf makes a slice of vals, of their type if they all have the same
+// one, or else of interface{}
+func sliceOf(vals []reflect.Value) reflect.Value {
+	t := interfaceType
+	for i, v := range vals {
+		if !v.IsValid() {
+			t = interfaceType
+			break
+		}
+		if i == 0 {
+			t = v.Type()
+		} else if v.Type() != t {
+			t = interfaceType
+			break
+		}
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(t), len(vals), len(vals))
+	for i, v := range vals {
+		if v.IsValid() {
+			out.Index(i).Set(v)
+		}
+	}
+	return out
+}
+
+// elementsOf returns the elements of the collection v, as a slice of its
+// element type
+func elementsOf(v reflect.Value, keep func(i int) bool) reflect.Value {
+	out := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if keep(i) {
+			out = reflect.Append(out, v.Index(i))
+		}
+	}
+	return out
+}
+
+// apply calls f with args, demoting a constant result and dereferencing
+// a pointer to a field
+func apply(f reflect.Value, args ...reflect.Value) reflect.Value {
+	v := call(f, args)
+	if !v.IsValid() {
+		return v
+	}
+	v = constDemote(v)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func mapOf(xs, f interface{}) interface{} {
+	v, fn := collection(xs), function(f)
+	vals := make([]reflect.Value, v.Len())
+	for i := range vals {
+		vals[i] = apply(fn, v.Index(i))
+	}
+	return sliceOf(vals).Interface()
+}
+
+func filter(xs, f interface{}) interface{} {
+	v, fn := collection(xs), function(f)
+	return elementsOf(v, func(i int) bool {
+		return truth(apply(fn, v.Index(i)))
+	}).Interface()
+}
+
+func reduce(xs, f, init interface{}) interface{} {
+	v, fn := collection(xs), function(f)
+	acc := reflect.ValueOf(init)
+	for i := 0; i < v.Len(); i++ {
+		acc = apply(fn, acc, v.Index(i))
+	}
+	if !acc.IsValid() {
+		return nil
+	}
+	return acc.Interface()
+}
+
+// sortKey is v as a constant for comparing, with C strings as strings
+func sortKey(v reflect.Value) constant.Value {
+	v = deref(v)
+	if !v.IsValid() {
+		panic("can't sort by nil")
+	}
+	if isCString(v.Type()) {
+		return constant.MakeString(cstr(v.Interface()))
+	}
+	return constPromote(v)
+}
+
+func sortby(xs, f interface{}) interface{} {
+	v, fn := collection(xs), function(f)
+	keys := make([]constant.Value, v.Len())
+	order := make([]int, v.Len())
+	for i := range keys {
+		keys[i] = sortKey(apply(fn, v.Index(i)))
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := keys[order[i]], keys[order[j]]
+		if !compatible(a, b) {
+			panic(fmt.Errorf("can't compare %s and %s", a.Kind(), b.Kind()))
+		}
+		return constant.Compare(a, token.LSS, b)
+	})
+
+	out := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+	for i, j := range order {
+		out.Index(i).Set(v.Index(j))
+	}
+	return out.Interface()
+}
+
+// groupKey is the text of v, with C strings as strings
+func groupKey(v reflect.Value) string {
+	v = deref(v)
+	if !v.IsValid() {
+		return "null"
+	}
+	if isCString(v.Type()) {
+		return cstr(v.Interface())
+	}
+	if c, ok := v.Interface().(constant.Value); ok && c.Kind() == constant.String {
+		return constant.StringVal(c)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func groupby(xs, f interface{}) interface{} {
+	v, fn := collection(xs), function(f)
+	groups := reflect.MakeMap(reflect.MapOf(reflect.TypeOf(""), reflect.SliceOf(v.Type().Elem())))
+	for i := 0; i < v.Len(); i++ {
+		key := reflect.ValueOf(groupKey(apply(fn, v.Index(i))))
+		group := groups.MapIndex(key)
+		if !group.IsValid() {
+			group = reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, 1)
+		}
+		groups.SetMapIndex(key, reflect.Append(group, v.Index(i)))
+	}
+	return groups.Interface()
+}
+
+// equalKey is v as a map key, so equal values have equal keys
+func equalKey(v reflect.Value) interface{} {
+	v = deref(v)
+	switch {
+	case !v.IsValid():
+		return nil
+	case isCString(v.Type()):
+		return cstr(v.Interface())
+	case v.Type().Comparable():
+		return v.Interface()
+	}
+	return fmt.Sprintf("%#v", v.Interface())
+}
+
+func uniq(xs interface{}) interface{} {
+	v := collection(xs)
+	seen := map[interface{}]bool{}
+	return elementsOf(v, func(i int) bool {
+		key := equalKey(v.Index(i))
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}).Interface()
+}
+
+func count(xs interface{}, f ...interface{}) int {
+	v := collection(xs)
+	switch len(f) {
+	case 0:
+		return v.Len()
+	case 1:
+	default:
+		panic("count takes at most two arguments")
+	}
+
+	fn, n := function(f[0]), 0
+	for i := 0; i < v.Len(); i++ {
+		if truth(apply(fn, v.Index(i))) {
+			n++
+		}
+	}
+	return n
+}
+
+// An indexed is an element of a collection, and its index
+type indexed struct {
+	Index int         `json:"index"`
+	Value interface{} `json:"value"`
+}
+
+func enumerate(xs interface{}) []indexed {
+	v := collection(xs)
+	out := make([]indexed, v.Len())
+	for i := range out {
+		out[i] = indexed{i, plain(v.Index(i))}
+	}
+	return out
+}
+
+func zip(xss ...interface{}) [][]interface{} {
+	if len(xss) == 0 {
+		panic("zip of nothing")
+	}
+	vs := make([]reflect.Value, len(xss))
+	n := -1
+	for i, xs := range xss {
+		vs[i] = collection(xs)
+		if n == -1 || vs[i].Len() < n {
+			n = vs[i].Len()
+		}
+	}
+
+	out := make([][]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		tuple := make([]interface{}, len(vs))
+		for j, v := range vs {
+			tuple[j] = plain(v.Index(i))
+		}
+		out = append(out, tuple)
+	}
+	return out
+}
+
+func compact(xs interface{}) interface{} {
+	v := collection(xs)
+	return elementsOf(v, func(i int) bool {
+		return !v.Index(i).IsZero()
+	}).Interface()
+}
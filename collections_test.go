@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestCollections(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `enumerate(fs.bbc.name)`, want: `[{"index":0,"value":"a   "},{"index":1,"value":"b   "},{"index":2,"value":"3C84"},{"index":3,"value":"d   "}]`},
+		{src: `enumerate(fs.bbc.freq)`, want: `[{"index":0,"value":100},{"index":1,"value":200},{"index":2,"value":300},{"index":3,"value":400}]`},
+		{src: `enumerate(fs.bbc)[1].index`, want: `1`},
+		{src: `zip(fs.bbc.name, fs.bbc.freq)`, want: `[["a   ",100],["b   ",200],["3C84",300],["d   ",400]]`},
+		{src: `zip(fs.bbc.freq, fs.bbc[0].bw)`, want: `[[100,4],[200,8]]`},
+		{src: `zip()`, err: "zip of nothing"},
+		{src: `map(fs.bbc.freq, func(f) { return f / 100 })`, want: `[1,2,3,4]`},
+		{src: `filter(fs.bbc.freq, func(f) { return f > 250 })`, want: `[300,400]`},
+		{src: `reduce(fs.bbc.freq, func(a, f) { return a + f }, 0)`, want: `1000`},
+		{src: `count(fs.bbc, func(b) { return b.freq < 300 })`, want: `2`},
+		{src: `enumerate(1)`, err: "int64 is not an array or slice"},
+	})
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxIndexCandidates is the longest array whose indices are offered as
+// completions
+const maxIndexCandidates = 64
+
+// A lexeme is a token of the line being completed
+type lexeme struct {
+	tok      token.Token
+	lit      string
+	off, end int
+}
+
+// A candidate is a possible completion, with the value it refers to
+type candidate struct {
+	text  string
+	value reflect.Value
+}
+
+// complete gives the possible completions of line. The expression before
+// the cursor is found from the tokens of the line, and completed with the
+// fields, methods, map keys or indices of its value, or with the global
+// names. When there are several candidates their types and values are
+// listed.
+func complete(terp *interpreter, line string) (c []string) {
+	lexemes, unterminated := lex(line)
+	n := len(lexemes)
+	spaced := len(line) > 0 && unicode.IsSpace(rune(line[len(line)-1]))
+
+	var cands []candidate
+	var head string // line before the text being completed
+
+	switch {
+	case n == 0:
+		cands = globals(terp, "")
+
+	case unterminated && lexemes[n-1].tok == token.STRING && n >= 2 && lexemes[n-2].tok == token.LBRACK:
+		// m["partial
+		last := lexemes[n-1]
+		recv, ok := receiver(terp, line, lexemes, n-3)
+		if !ok {
+			return nil
+		}
+		head = line[:last.off]
+		cands = keys(recv, last.lit[1:])
+
+	case spaced:
+		if !expectsOperand(lexemes[n-1].tok) {
+			return nil
+		}
+		head = line
+		cands = globals(terp, "")
+
+	case lexemes[n-1].tok == token.PERIOD:
+		recv, ok := receiver(terp, line, lexemes, n-2)
+		if !ok {
+			return nil
+		}
+		head = line
+		cands = members(terp, recv, "")
+
+	case lexemes[n-1].tok == token.LBRACK:
+		recv, ok := receiver(terp, line, lexemes, n-2)
+		if !ok {
+			return nil
+		}
+		head = line
+		cands = append(keys(recv, ""), indices(recv)...)
+
+	case lexemes[n-1].tok == token.IDENT:
+		last := lexemes[n-1]
+		head = line[:last.off]
+		if n >= 2 && lexemes[n-2].tok == token.PERIOD {
+			recv, ok := receiver(terp, line, lexemes, n-3)
+			if !ok {
+				return nil
+			}
+			cands = members(terp, recv, last.lit)
+		} else {
+			cands = globals(terp, last.lit)
+		}
+
+	case expectsOperand(lexemes[n-1].tok):
+		head = line
+		cands = globals(terp, "")
+	}
+
+	if len(cands) > 1 {
+		list(cands)
+	}
+	for _, cand := range cands {
+		c = append(c, head+cand.text)
+	}
+	return c
+}
+
+// lex splits line into tokens, reporting if it ends in an unterminated
+// string
+func lex(line string) (lexemes []lexeme, unterminated bool) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(line))
+	var s scanner.Scanner
+	s.Init(file, []byte(line), func(pos token.Position, msg string) {
+		if strings.HasSuffix(msg, "not terminated") {
+			unterminated = true
+		}
+	}, 0)
+
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		off := file.Offset(pos)
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		lexemes = append(lexemes, lexeme{tok, lit, off, off + len(text)})
+	}
+	return lexemes, unterminated
+}
+
+// expectsOperand reports if an operand may follow tok
+func expectsOperand(tok token.Token) bool {
+	switch tok {
+	case token.LPAREN, token.LBRACK, token.LBRACE, token.COMMA, token.SEMICOLON,
+		token.ASSIGN, token.DEFINE, token.NOT, token.COLON:
+		return true
+	}
+	return tok.Precedence() > 0
+}
+
+// receiver evaluates the operand ending with lexeme i. Operands with calls
+// aren't evaluated, as completing shouldn't run anything.
+func receiver(terp *interpreter, line string, lexemes []lexeme, i int) (reflect.Value, bool) {
+	start := operandStart(lexemes, i)
+	if start < 0 {
+		return reflect.Value{}, false
+	}
+
+	src := line[lexemes[start].off:lexemes[i].end]
+	exp, err := parseExpr(src)
+	if err != nil || hasCall(exp) {
+		return reflect.Value{}, false
+	}
+	v, err := terp.Eval(src)
+	if err != nil || !v.IsValid() {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// hasCall reports if exp contains a call
+func hasCall(exp ast.Expr) bool {
+	found := false
+	ast.Inspect(exp, func(n ast.Node) bool {
+		if _, ok := n.(*ast.CallExpr); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// operandStart finds the first lexeme of the operand ending with lexeme i:
+// a chain of selectors, indices and calls. It returns -1 if there is none.
+func operandStart(lexemes []lexeme, i int) int {
+	for i >= 0 {
+		switch lexemes[i].tok {
+		case token.RPAREN, token.RBRACK:
+			depth := 0
+			for ; i >= 0; i-- {
+				switch lexemes[i].tok {
+				case token.RPAREN, token.RBRACK:
+					depth++
+				case token.LPAREN, token.LBRACK:
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			if i < 0 {
+				return -1
+			}
+			if i > 0 {
+				switch lexemes[i-1].tok {
+				case token.IDENT, token.RPAREN, token.RBRACK:
+					i--
+					continue
+				}
+			}
+			return i
+		case token.IDENT:
+			if i > 1 && lexemes[i-1].tok == token.PERIOD {
+				i -= 2
+				continue
+			}
+			return i
+		case token.STRING, token.INT, token.FLOAT, token.CHAR:
+			return i
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// globals are the global and local names starting with prefix
+func globals(terp *interpreter, prefix string) []candidate {
+	scope := make(map[string]reflect.Value)
+	for name, v := range terp.globals {
+		scope[name] = v
+	}
+	for _, locals := range terp.locals {
+		for name, v := range locals {
+			scope[name] = v
+		}
+	}
+
+	var cands []candidate
+	for name, v := range scope {
+		name = userName(name)
+		if strings.HasPrefix(name, prefix) {
+			cands = append(cands, candidate{name, v})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].text < cands[j].text })
+	return cands
+}
+
+// members are the fields and methods of v starting with prefix
+func members(terp *interpreter, v reflect.Value, prefix string) []candidate {
+	var cands []candidate
+	for i := 0; i < v.NumMethod(); i++ {
+		name := v.Type().Method(i).Name
+		if strings.HasPrefix(name, prefix) {
+			cands = append(cands, candidate{name, v.Method(i)})
+		}
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return cands
+		}
+		v = v.Elem()
+	}
+	if (v.Kind() == reflect.Array || v.Kind() == reflect.Slice) && !isCString(v.Type()) && v.Len() > 0 {
+		// fields of the elements, selected from each
+		t := v.Type().Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if e := deref(v.Index(0)); t.Kind() == reflect.Struct && e.IsValid() {
+			for _, c := range members(terp, e, prefix) {
+				if c.value.Kind() != reflect.Func {
+					cands = append(cands, candidate{c.text, terp.eachField(v, c.text)})
+				}
+			}
+		}
+		return cands
+	}
+	if v.Kind() != reflect.Struct {
+		return cands
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Name
+		if terp.Tag != "" {
+			s, ok := tagName(field, terp.Tag)
+			if !ok {
+				continue
+			}
+			name = s
+		}
+		if strings.HasPrefix(name, prefix) {
+			cands = append(cands, candidate{name, v.Field(i)})
+		}
+	}
+	return cands
+}
+
+// keys are the map keys of v starting with prefix, as index expressions
+func keys(v reflect.Value, prefix string) []candidate {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Map {
+		return nil
+	}
+
+	var cands []candidate
+	for _, key := range v.MapKeys() {
+		var text string
+		switch {
+		case key.Kind() == reflect.String:
+			if !strings.HasPrefix(key.String(), prefix) {
+				continue
+			}
+			text = strconv.Quote(key.String())
+		case prefix == "":
+			text = fmt.Sprint(key)
+		default:
+			continue
+		}
+		cands = append(cands, candidate{text + "]", v.MapIndex(key)})
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].text < cands[j].text })
+	return cands
+}
+
+// indices are the valid indices of array or slice v
+func indices(v reflect.Value) []candidate {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+		return nil
+	}
+
+	if v.Len() > maxIndexCandidates {
+		fmt.Fprintf(os.Stdout, "\r\nindex 0 to %d\r\n", v.Len()-1)
+		return nil
+	}
+	cands := make([]candidate, v.Len())
+	for i := range cands {
+		cands[i] = candidate{strconv.Itoa(i) + "]", v.Index(i)}
+	}
+	return cands
+}
+
+// list prints the candidates with their types and a preview of their values
+func list(cands []candidate) {
+	width := 0
+	for _, cand := range cands {
+		if len(cand.text) > width {
+			width = len(cand.text)
+		}
+	}
+
+	fmt.Print("\r\n")
+	for _, cand := range cands {
+		typ := ""
+		if cand.value.IsValid() {
+			typ = cand.value.Type().String()
+		}
+		if len(typ) > 20 {
+			typ = typ[:17] + "..."
+		}
+		fmt.Printf("%-*s  %-20s %s\r\n", width, cand.text, typ, preview(cand.value))
+	}
+}
+
+// preview is a short description of the value of v
+func preview(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() == reflect.Func {
+		return ""
+	}
+	for v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() != reflect.Func {
+		v = v.Elem()
+	}
+
+	var s string
+	if b, err := json.Marshal(truncate(v, 0)); err == nil {
+		s = string(b)
+	} else if v.CanInterface() {
+		s = fmt.Sprint(v.Interface())
+	}
+	if len(s) > 40 {
+		s = s[:37] + "..."
+	}
+	return s
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	terp := testInterp()
+	terp.Eval(`f = func() { printf("called f"); return fs }`)
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"ma", []string{"map", "match", "max"}},
+		{"fs.ls", []string{"fs.lsorna"}},
+		{"fs.bbc[1].f", []string{"fs.bbc[1].freq"}},
+		{"fs.equip.", []string{"fs.equip.rack"}},
+		{"sum(fs.bbc.ts", []string{"sum(fs.bbc.tsys"}},
+		{"f().ls", nil},
+		{"fs.nothing.", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		out := capture(t, &os.Stdout, func() { got = complete(terp, tt.line) })
+		if strings.Contains(out, "called f") {
+			t.Errorf("complete(%q) called f", tt.line)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("complete(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"text/tabwriter"
+)
+
+// describe(x[, depth]) prints the type structure of x, to depth levels of
+// fields (default 1), with the values of its scalar fields
+func describe(x interface{}, depth ...int) {
+	d := 1
+	if len(depth) > 0 {
+		d = depth[0]
+	}
+
+	v := reflect.ValueOf(x)
+	if !v.IsValid() {
+		panic("describe called with no value")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	describeTree(w, "", "", "", v.Type(), v, d)
+	w.Flush()
+}
+
+// describeType prints the whole structure of type t, without values
+func describeType(out io.Writer, name string, t reflect.Type) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	describeTree(w, "", name, "", t, reflect.Value{}, -1)
+	w.Flush()
+}
+
+// describeTree writes a line for the field name of type t, and then its
+// fields to depth more levels, or all if depth is negative. The values of
+// scalars are shown if v is valid.
+func describeTree(w io.Writer, indent, name, tag string, t reflect.Type, v reflect.Value, depth int) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if v.IsValid() && !v.IsNil() {
+			v = v.Elem()
+		} else {
+			v = reflect.Value{}
+		}
+	}
+
+	value := ""
+	if v.IsValid() && leafType(t) {
+		// small arrays are shown whole
+		if b, err := json.Marshal(truncate(v, 1)); err == nil {
+			value = "= " + string(b)
+		}
+	}
+	fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\n", indent, name, tag, typeName(t), value)
+
+	if depth == 0 {
+		return
+	}
+
+	// descend into the elements of arrays of structs, without values
+	elem := t
+	for elem.Kind() == reflect.Array || elem.Kind() == reflect.Slice {
+		elem = elem.Elem()
+		v = reflect.Value{}
+	}
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+		v = reflect.Value{}
+	}
+	if elem.Kind() != reflect.Struct || elem.PkgPath() == "time" {
+		return
+	}
+
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := ""
+		if s, ok := tagName(field, "json"); ok {
+			if s == "-" {
+				continue
+			}
+			tag = "(" + s + ")"
+		}
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+		describeTree(w, indent+"  ", field.Name, tag, field.Type, fv, depth-1)
+	}
+}
+
+// leafType reports if values of type t are shown whole
+func leafType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct:
+		return t.PkgPath() == "time"
+	case reflect.Array, reflect.Slice:
+		return isCString(t) || leafType(t.Elem()) && t.Kind() == reflect.Array && t.Len() <= 8
+	case reflect.Map, reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
+
+// typeName is the name of t, with the fields of unnamed structs left out
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), typeName(t.Elem()))
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case reflect.Ptr:
+		return "*" + typeName(t.Elem())
+	case reflect.Struct:
+		return "struct{...}"
+	}
+	return t.String()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// An enum names the codes of a field, keyed by the code in decimal
+type enum map[string]string
+
+// equipTypes are the rack and drive type codes of the FS, from the
+// constants in params.h
+var equipTypes = enum{
+	"0":  "none",
+	"1":  "mk3",
+	"2":  "vlba",
+	"4":  "mk4",
+	"8":  "s2",
+	"16": "vlba4",
+	"32": "k4",
+}
+
+// fieldEnums are the enums of fields, keyed by json path without indices as
+// for fieldNote. Codes added in later FS versions, or local ones, are added
+// or replaced in enums.json, eg
+//
+//	{"equip.rack": {"512": "dbbc"}}
+var fieldEnums = map[string]enum{
+	"equip.rack":  equipTypes,
+	"equip.drive": equipTypes,
+}
+
+var enumsLoaded bool
+
+// showEnums is set to show the names of enum codes in JSON output
+var showEnums bool
+
+// loadEnums adds the enums in fsq/enums.json in the user's config
+// directory, or $FSQ_ENUMS, to fieldEnums
+func loadEnums() error {
+	if enumsLoaded {
+		return nil
+	}
+	enumsLoaded = true
+
+	local := map[string]enum{}
+	if err := readConfig("FSQ_ENUMS", "enums.json", &local); err != nil {
+		return err
+	}
+	for path, e := range local {
+		merged := enum{}
+		for code, name := range fieldEnums[path] {
+			merged[code] = name
+		}
+		for code, name := range e {
+			merged[code] = name
+		}
+		fieldEnums[path] = merged
+	}
+	return nil
+}
+
+// name returns the name of code, if it has one
+func (e enum) name(code float64) (string, bool) {
+	if code != math.Trunc(code) {
+		return "", false
+	}
+	name, ok := e[strconv.FormatInt(int64(code), 10)]
+	return name, ok
+}
+
+// enumOf(x[, path]) is the names of the codes in x, a field or array of
+// them. The enum is found from the field x selects, or by path.
+func enumOf(terp *interpreter, args []ast.Expr) reflect.Value {
+	if len(args) == 0 || len(args) > 2 {
+		panic("enum takes one or two arguments")
+	}
+	if err := loadEnums(); err != nil {
+		panic(err)
+	}
+
+	path := strings.Join(fieldPath(args[0]), ".")
+	if len(args) == 2 {
+		path = text(terp.eval(args[1]))
+	}
+	e, ok := fieldEnums[path]
+	if !ok {
+		panic(fmt.Errorf("no enum for %q", path))
+	}
+
+	return reflect.ValueOf(numberwise(terp.eval(args[0]), func(code float64) interface{} {
+		if name, ok := e.name(code); ok {
+			return name
+		}
+		return code
+	}))
+}
+
+// enumName is the name of the code v in the enum of path, if it has one
+func enumName(v reflect.Value, path []string) (string, bool) {
+	e, ok := fieldEnums[strings.Join(path, ".")]
+	if !ok {
+		return "", false
+	}
+	return e.name(number(v))
+}
@@ -0,0 +1,25 @@
+package main
+
+// fieldDocs describe shared memory fields, from the comments in fscom.h.
+// Only the core fields are here; go generate rebuilds the table from the
+// headers of an FS installation.
+var fieldDocs = map[string]fieldNote{
+	"alat":        {"alat", "station latitude, radians"},
+	"dec50":       {"dec50", "source declination, 1950, radians"},
+	"decdat":      {"decdat", "source declination of date, radians"},
+	"diaman":      {"diaman", "antenna diameter, meters"},
+	"epoch":       {"epoch", "epoch of the source position"},
+	"equip.drive": {"drive", "drive types"},
+	"equip.rack":  {"rack", "rack type"},
+	"height":      {"height", "station height, meters"},
+	"humiwx":      {"humiwx", "relative humidity, percent"},
+	"ionsor":      {"ionsor", "on source flag"},
+	"lexper":      {"lexper", "experiment name"},
+	"lskd":        {"lskd", "schedule name"},
+	"lsorna":      {"lsorna", "source name"},
+	"preswx":      {"preswx", "atmospheric pressure, mbar"},
+	"ra50":        {"ra50", "source right ascension, 1950, radians"},
+	"radat":       {"radat", "source right ascension of date, radians"},
+	"tempwx":      {"tempwx", "temperature, Celsius"},
+	"wlong":       {"wlong", "station west longitude, radians"},
+}
@@ -0,0 +1,161 @@
+//go:build ignore
+
+// fscomdoc writes the descriptions of shared memory fields in fielddoc.go,
+// from the comments on the members of struct fscom and the structs it
+// contains. Give it fscom.h and the headers defining those structs:
+//
+//	go run fscomdoc.go -o fielddoc.go /usr2/fs/include/*.h
+//
+// Fields are keyed by json path, as help looks them up, from the Go type of
+// the shared memory: C members are matched to Go fields by name, ignoring
+// case, and members without a field are left out.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nvi-inc/fsgo"
+)
+
+type member struct {
+	typ, name, doc string
+}
+
+var (
+	structStart = regexp.MustCompile(`^\s*(?:typedef\s+)?struct\s+(\w+)\s*\{`)
+	structEnd   = regexp.MustCompile(`^\s*\}`)
+	memberLine  = regexp.MustCompile(`^\s*((?:struct|unsigned|signed|long|short)\s+\w+|\w+)\s+([^;]+);\s*(?:/\*(.*?)\*/|//(.*))?`)
+	arrayDims   = regexp.MustCompile(`\[[^\]]*\]`)
+)
+
+func main() {
+	out := flag.String("o", "fielddoc.go", "output `file`")
+	root := flag.String("root", "fscom", "root `struct`")
+	flag.Parse()
+
+	structs := make(map[string][]member)
+	for _, name := range flag.Args() {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		parse(string(b), structs)
+	}
+	if _, ok := structs[*root]; !ok {
+		log.Fatalf("struct %s not found", *root)
+	}
+
+	docs := make(map[string][2]string)
+	walk(structs, *root, reflect.TypeOf(fs.Attach).Out(0), "", docs, 0)
+
+	paths := make([]string, 0, len(docs))
+	for p := range docs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// Code generated by fscomdoc.go; DO NOT EDIT.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "package main")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "// fieldDocs describe shared memory fields, from the comments in fscom.h")
+	fmt.Fprintln(&buf, "var fieldDocs = map[string]fieldNote{")
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "\t%q: {%q, %q},\n", p, docs[p][0], docs[p][1])
+	}
+	fmt.Fprintln(&buf, "}")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parse adds the members of the structs defined in src to structs
+func parse(src string, structs map[string][]member) {
+	var name string
+	for _, line := range strings.Split(src, "\n") {
+		if m := structStart.FindStringSubmatch(line); m != nil {
+			name = m[1]
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if structEnd.MatchString(line) {
+			name = ""
+			continue
+		}
+
+		m := memberLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		doc := strings.TrimSpace(m[3] + m[4])
+		for _, n := range strings.Split(m[2], ",") {
+			n = strings.Trim(arrayDims.ReplaceAllString(n, ""), " *\t")
+			if n != "" {
+				structs[name] = append(structs[name], member{m[1], n, doc})
+			}
+		}
+	}
+}
+
+// walk records the documented members of struct name, and of the structs
+// it contains, by the json path of the fields of t they are
+func walk(structs map[string][]member, name string, t reflect.Type, prefix string, docs map[string][2]string, depth int) {
+	if depth > 16 {
+		return
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for _, m := range structs[name] {
+		field, ok := goField(t, m.name)
+		if !ok {
+			continue
+		}
+		path := prefix + jsonName(field)
+		if m.doc != "" {
+			docs[path] = [2]string{m.name, m.doc}
+		}
+		if strings.HasPrefix(m.typ, "struct ") {
+			walk(structs, strings.TrimPrefix(m.typ, "struct "), field.Type, path+".", docs, depth+1)
+		}
+	}
+}
+
+// goField is the field of struct type t for the C member name
+func goField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonName is the name of field f in JSON
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
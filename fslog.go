@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// fslogTime formats t as in FS logs, yyyy.ddd.hh:mm:ss.ss in UTC
+func fslogTime(t time.Time) string {
+	t = t.UTC()
+	return fmt.Sprintf("%04d.%03d.%02d:%02d:%02d.%02d",
+		t.Year(), t.YearDay(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1e7)
+}
+
+// fslogLine formats v as an FS log line from fsq, named name. Leaves of v
+// are flattened to a list of key=value, where the key is the json path to
+// the leaf. A scalar is given the key "value". Keys, values and the name
+// are quoted if need be.
+func fslogLine(t time.Time, name string, v reflect.Value) string {
+	params := []string{}
+	walk(v, "json", nil, func(path []string, v reflect.Value) {
+		key := strings.Join(path, ".")
+		if key == "" {
+			key = "value"
+		}
+		params = append(params, fslogQuote(key)+"="+fslogQuote(fslogValue(v)))
+	})
+	return fslogTime(t) + "/fsq/" + fslogQuote(name) + "," + strings.Join(params, ",")
+}
+
+// fslogQuote quotes s as a Go string if it has characters that would split
+// a parameter or record of an FS log line: commas, slashes, spaces, quotes,
+// backslashes or control characters
+func fslogQuote(s string) string {
+	special := func(r rune) bool {
+		return strings.ContainsRune(`,/ "\`, r) || unicode.IsControl(r)
+	}
+	if strings.IndexFunc(s, special) == -1 {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func fslogValue(v reflect.Value) string {
+	if v.CanInterface() {
+		if cv, ok := v.Interface().(constant.Value); ok {
+			if cv.Kind() == constant.String {
+				return constant.StringVal(cv)
+			}
+			return cv.String()
+		}
+	}
+
+	switch {
+	case isCString(v.Type()):
+		return strings.TrimRight(cstr(v.Interface()), " ")
+	case v.Type() == timeType:
+		return fslogTime(v.Interface().(time.Time))
+	case isFloat(v):
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// A logLine is a formatted FS log line, as given by fslog()
+type logLine string
+
+func encodeFSLog(w io.Writer, label string, v reflect.Value) error {
+	if line, ok := v.Interface().(logLine); ok {
+		_, err := fmt.Fprintln(w, line)
+		return err
+	}
+	_, err := fmt.Fprintln(w, fslogLine(time.Now(), labelName(label), v))
+	return err
+}
+
+// fslog(expr[, name]) formats the value of expr as an FS log line, named
+// after the last field of expr
+func fslog(terp *interpreter, args []ast.Expr) reflect.Value {
+	if len(args) < 1 || len(args) > 2 {
+		panic("fslog takes an expression and an optional name")
+	}
+
+	name := astName(args[0])
+	if len(args) == 2 {
+		name = cstr(constDemote(terp.eval(args[1])).Interface())
+	}
+	if name == "" {
+		name = "fsq"
+	}
+	return reflect.ValueOf(logLine(fslogLine(time.Now(), name, terp.eval(args[0]))))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFSLogLine(t *testing.T) {
+	at := time.Date(2026, 10, 16, 12, 0, 1, 230000000, time.UTC)
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"tsys", 50.5, "2026.289.12:00:01.23/fsq/tsys,value=50.5"},
+		{"src", "3C84", "2026.289.12:00:01.23/fsq/src,value=3C84"},
+		{"src", "a, b/c", `2026.289.12:00:01.23/fsq/src,value="a, b/c"`},
+		{"note", "say \"hi\"\n", `2026.289.12:00:01.23/fsq/note,value="say \"hi\"\n"`},
+		{"a,b", 1, `2026.289.12:00:01.23/fsq/"a,b",value=1`},
+		{"m", map[string]string{"x y": "1", "z": ""}, `2026.289.12:00:01.23/fsq/m,"x y"=1,z=`},
+		{"bbc", newTestShm().Bbc[0], "2026.289.12:00:01.23/fsq/bbc,freq=100,bw.0=4,bw.1=8,name=a,tsys=0"},
+	}
+	for _, tt := range tests {
+		got := fslogLine(at, tt.name, reflect.ValueOf(tt.v))
+		if got != tt.want {
+			t.Errorf("fslogLine(%q, %v) = %s, want %s", tt.name, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestFSLogRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 16, 12, 0, 1, 230000000, time.UTC)
+	v := struct {
+		Source string `json:"source"`
+		Note   string `json:"note"`
+		Freq   int    `json:"freq"`
+	}{"3C84", `a,b "c"`, 100}
+
+	rec, ok := parseLogLine(fslogLine(at, "obs", reflect.ValueOf(v)))
+	if !ok {
+		t.Fatal("line not parsed")
+	}
+	want := []string{"obs", "source=3C84", `note="a,b \"c\""`, "freq=100"}
+	if rec.Name != "fsq" || !reflect.DeepEqual(rec.Params, want) || !rec.Time.Equal(at) {
+		t.Errorf("got %s %q at %s, want fsq %q at %s", rec.Name, rec.Params, rec.Time, want, at)
+	}
+}
+
+func TestSplitParams(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"a,b,c", []string{"a", "b", "c"}},
+		{"", []string{""}},
+		{`x="1,2",y`, []string{`x="1,2"`, "y"}},
+		{`"a,b"=1,c`, []string{`"a,b"=1`, "c"}},
+		{`x="a\",b",y`, []string{`x="a\",b"`, "y"}},
+		{`it's "odd,ly",quoted`, []string{`it's "odd`, `ly"`, "quoted"}},
+	}
+	for _, tt := range tests {
+		if got := splitParams(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitParams(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -1,20 +1,14 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"go/constant"
 	"os"
-	"path/filepath"
 	"reflect"
-	"strings"
 
 	"github.com/nvi-inc/fsgo"
-	"github.com/peterh/liner"
 )
 
-var history_path = filepath.Join(os.TempDir(), "fsqhistory")
-
 func cstr(in interface{}) string {
 	v := reflect.ValueOf(in)
 	for v.Kind() == reflect.Ptr {
@@ -27,6 +21,12 @@ func cstr(in interface{}) string {
 		if v.Type().Elem().Kind() != reflect.Uint8 {
 			panic("argument to \"str\" is not a string")
 		}
+		if !v.CanAddr() {
+			// arrays must be addressable to slice
+			a := reflect.New(v.Type()).Elem()
+			a.Set(v)
+			v = a
+		}
 		s = string(v.Slice(0, v.Len()).Bytes())
 	case reflect.String:
 		s = v.String()
@@ -40,148 +40,110 @@ func cstr(in interface{}) string {
 	return s[:i]
 }
 
-func complete(terp *interpreter, line string) (c []string) {
-	i := len(line)
-	if i > 0 {
-		i--
-	}
-
-	// trace backwards to find the beginning of the current sub-expression
-	for i > 0 && line[i] != '.' && line[i] != '(' && line[i] != '[' {
-		i--
-	}
+// commands are the subcommands of fsq, selected by the first argument
+var commands = map[string]func(args []string){
+	"push":   pushMain,
+	"mqtt":   mqttMain,
+	"log":    logMain,
+	"schema": schemaMain,
+	"sql":    sqlMain,
+}
 
-	expression := ""
-	prefix := line[:i]
-	search := line[i:]
-	if i > 0 {
-		// Trim off '.' '(' or '['
-		prefix = line[:i+1]
-		search = search[1:]
-
-		j := i - 1
-		nper := 0
-		nsqb := 0
-		for j > 0 && line[j] != '=' {
-			switch line[j] {
-			case '(':
-				nper--
-			case ')':
-				nper++
-			case '[':
-				nsqb--
-			case ']':
-				nsqb++
-			}
-			if nper < 0 || nsqb < 0 {
-				break
-			}
+// outputFormat is the format results are displayed in
+var outputFormat = "json"
 
-			j--
-		}
+// newInterp returns an interpreter with the builtins
+func newInterp() *interpreter {
+	terp := NewInterpreter()
+	terp.Tag = "json"
+	register(terp, builtins)
+	return terp
+}
 
-		if i != j {
-			expression = line[j:i]
-			if j != 0 {
-				// Trim off '=' '(' or '['
-				expression = expression[1:]
-			}
-		}
-	}
+// fsType is the type bound to fs
+func fsType() reflect.Type {
+	return reflect.TypeOf(fs.Attach).Out(0)
+}
 
-	value, err := terp.Eval(fmt.Sprintf("ls(%s)", expression))
+// attach connects to the FS shared memory and binds it to fs
+func attach(terp *interpreter) error {
+	fsshm, err := fs.Attach()
 	if err != nil {
-		return
-	}
-
-	names, ok := value.Interface().([]string)
-	if !ok {
-		return
+		return err
 	}
-
-	for _, n := range names {
-		if strings.HasPrefix(n, search) {
-			c = append(c, prefix+n)
-		}
-	}
-	return
-}
-
-func help() {
-	fmt.Println(`Help should go here
-
-	blag
-
-	`)
+	terp.Global("fs", fsshm)
+	return nil
 }
 
-func main() {
-	fsshm, err := fs.Attach()
+// setup attaches to the FS and returns an interpreter with the usual globals
+func setup() *interpreter {
+	terp := newInterp()
 
-	if err != nil {
+	if err := attach(terp); err != nil {
 		fmt.Println("error conencting to the FS:", err)
 		os.Exit(1)
 	}
 
-	terp := NewInterpreter()
-	terp.Tag = "json"
-	terp.Global("fs", fsshm)
-	terp.Global("str", cstr)
-	terp.Global("help", help)
-
-	lr := liner.NewLiner()
-	defer lr.Close()
+	loadInit(terp)
+	return terp
+}
 
-	lr.SetCompleter(func(line string) []string {
-		return complete(terp, line)
-	})
+func main() {
+	flag.StringVar(&outputFormat, "o", outputFormat, "output `format`: json, influx, fslog, table or csv")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), `usage: fsq [flags] [expression...]
+       fsq push -influx url [flags] expression...
+       fsq mqtt -broker url -config topics.yaml [flags]
+       fsq log [flags] file...
+       fsq schema [flags]
+       fsq sql [flags] [query...]`)
+		flag.PrintDefaults()
+	}
+	schema := flag.Bool("schema", false, "print the structure of fs and exit")
+	flag.StringVar(&jqProgram, "jq", "", "apply the jq `filter` to each result")
+	flag.Parse()
 
-	encoder := json.NewEncoder(os.Stdout)
-	if liner.TerminalSupported() {
-		encoder.SetIndent("", " ")
+	if *schema {
+		describeType(os.Stdout, "fs", fsType())
+		return
 	}
 
-	for {
-		line, err := lr.Prompt("> ")
-		if err != nil { // io.EOF
-			break
-		}
+	if cmd, ok := commands[flag.Arg(0)]; ok {
+		cmd(flag.Args()[1:])
+		return
+	}
 
-		lr.AppendHistory(line)
-		for _, line = range strings.Split(line, ";") {
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
+	run(setup(), flag.Args())
+}
 
-			value, err := terp.Eval(line)
-			if err != nil {
-				fmt.Println("error:", err)
-				continue
-			}
-			if !value.IsValid() {
-				continue
-			}
+// run evaluates and displays each expression in exps, or starts an
+// interactive session if there are none
+func run(terp *interpreter, exps []string) {
+	if _, ok := encoders[outputFormat]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", outputFormat)
+		os.Exit(2)
+	}
+	if _, err := compileJQ(jqProgram); err != nil {
+		fmt.Fprintln(os.Stderr, "jq:", err)
+		os.Exit(2)
+	}
 
-			switch value.Kind() {
-			case reflect.Func:
-				if value.Type().NumIn() == 0 && value.Type().NumOut() == 0 {
-					value.Call([]reflect.Value{})
-					continue
-				}
-				fmt.Println(value.Type())
-				continue
-			case reflect.Struct:
-				if cv, ok := value.Interface().(constant.Value); ok {
-					fmt.Println(cv)
-					continue
+	if len(exps) > 0 {
+		for _, exp := range exps {
+			stmts, _, _ := statements(exp)
+			for _, stmt := range stmts {
+				value, err := terp.Eval(stmt.src)
+				if err != nil {
+					fmt.Println("error:", err)
+					os.Exit(1)
 				}
-			}
-
-			err = encoder.Encode(value.Interface())
-			if err != nil {
-				fmt.Println(err)
+				display(os.Stdout, outputFormat, stmt.src, value)
 			}
 		}
+		return
 	}
+
+	s := newSession(terp)
+	defer s.Close()
+	s.repl()
 }
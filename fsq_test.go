@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testBbc and testShm are a small stand in for the FS shared memory. C
+// strings are blank padded, as in the FS.
+type testBbc struct {
+	Freq int32    `json:"freq"`
+	Bw   [2]int32 `json:"bw"`
+	Name [4]byte  `json:"name"`
+	Tsys float32  `json:"tsys"`
+}
+
+type testShm struct {
+	Lsorna [10]byte   `json:"lsorna"`
+	Bbc    [4]testBbc `json:"bbc"`
+	Equip  struct {
+		Rack int32 `json:"rack"`
+	} `json:"equip"`
+	Iclbox uint16   `json:"iclbox"`
+	Time   [6]int32 `json:"time"`
+}
+
+func newTestShm() *testShm {
+	shm := &testShm{}
+	copy(shm.Lsorna[:], "3C84      ")
+	for i := range shm.Bbc {
+		b := &shm.Bbc[i]
+		b.Freq = int32(100 * (i + 1))
+		b.Bw = [2]int32{4, 8}
+		copy(b.Name[:], string(rune('a'+i))+"   ")
+		b.Tsys = float32(50 * i)
+	}
+	copy(shm.Bbc[2].Name[:], "3C84")
+	shm.Bbc[3].Tsys = float32(math.NaN())
+	shm.Equip.Rack = 4
+	shm.Iclbox = 0x8005
+	shm.Time = [6]int32{23, 1, 0, 12, 289, 2026}
+	return shm
+}
+
+// testInterp returns an interpreter with the builtins and fs bound to a
+// testShm
+func testInterp() *interpreter {
+	terp := newInterp()
+	terp.Global("fs", newTestShm())
+	return terp
+}
+
+// evalJSON evaluates src with terp and returns the result as JSON
+func evalJSON(t *testing.T, terp *interpreter, src string) string {
+	t.Helper()
+	v, err := terp.Eval(src)
+	if err != nil {
+		t.Fatalf("%s: %s", src, err)
+	}
+	var buf bytes.Buffer
+	if err := encode(encodeJSON, &buf, src, v); err != nil {
+		t.Fatalf("%s: %s", src, err)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// An evalTest is an expression and its result as JSON, or the start of the
+// error it gives
+type evalTest struct {
+	src  string
+	want string
+	err  string
+}
+
+func runEvalTests(t *testing.T, tests []evalTest) {
+	t.Helper()
+	terp := testInterp()
+	for _, tt := range tests {
+		if tt.err != "" {
+			_, err := terp.Eval(tt.src)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.src, err, tt.err)
+			}
+			continue
+		}
+		if got := evalJSON(t, terp, tt.src); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var timeBuiltins = []builtin{
+	{"fstime", fstime, "fstime(x...)", "time of an FS time string, it[6] array (centisec, sec, min, hour, doy, year), year, doy and seconds, Unix seconds, or n \"sec\" or \"centisec\" units after time t0 (the Unix epoch by default) as fstime(n, unit[, t0])"},
+	{"now", now, "now()", "current time"},
+	{"doy", doy, "doy(t)", "day of year of time t"},
+	{"mjd", mjd, "mjd(t)", "Modified Julian Date of time t"},
+	{"unix", unix, "unix(t)", "seconds since 1970 of time t"},
+	{"rfc3339", rfc3339, "rfc3339(t)", "time t as an RFC 3339 string"},
+	{"since", since, "since(t)", "seconds since time t"},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// mjdUnix is the Modified Julian Date of the Unix epoch
+const mjdUnix = 40587
+
+// toTime converts v to a time. v may be a time, a string as taken by
+// logTime with times of day on the day of ref, an it[6] array, a
+// [year, doy, seconds] array or Unix seconds.
+func toTime(v reflect.Value, ref time.Time) time.Time {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			panic("nil is not a time")
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time)
+	}
+	if v.Kind() == reflect.String || isCString(v.Type()) {
+		return logTime(text(v), ref)
+	}
+	if elems, ok := elements(v); ok {
+		return fieldsTime(elems)
+	}
+	return counterTime(number(v), "sec", time.Unix(0, 0))
+}
+
+// timeUnits are the nanoseconds in each unit of a counter
+var timeUnits = map[string]float64{
+	"sec":      1e9,
+	"centisec": 1e7,
+}
+
+// counterTime is the time n units after epoch, to the nearest nanosecond
+func counterTime(n float64, unit string, epoch time.Time) time.Time {
+	ns, ok := timeUnits[unit]
+	if !ok {
+		panic(fmt.Errorf("unknown time unit %q, want sec or centisec", unit))
+	}
+	// whole units separately, so large counts don't lose precision
+	whole, frac := math.Modf(n)
+	d := time.Duration(whole)*time.Duration(ns) + time.Duration(math.Round(frac*ns))
+	return epoch.Add(d).UTC()
+}
+
+// fieldsTime is the time of an it[6] array, or year, doy and seconds
+func fieldsTime(elems []reflect.Value) time.Time {
+	f := make([]float64, len(elems))
+	for i, e := range elems {
+		f[i] = number(e)
+	}
+	switch len(f) {
+	case 6:
+		return fsDate(int(f[5]), int(f[4]), int(f[3]), int(f[2]), f[1]+f[0]/100)
+	case 3:
+		return fsDate(int(f[0]), int(f[1]), 0, 0, f[2])
+	}
+	panic(fmt.Errorf("can't make a time from %d numbers", len(f)))
+}
+
+func fstime(args ...interface{}) time.Time {
+	if len(args) == 2 || len(args) == 3 && isStrings(reflect.ValueOf(args[1])) {
+		epoch := time.Unix(0, 0)
+		if len(args) == 3 {
+			epoch = toTime(reflect.ValueOf(args[2]), time.Now())
+		}
+		return counterTime(number(reflect.ValueOf(args[0])), text(reflect.ValueOf(args[1])), epoch)
+	}
+
+	switch len(args) {
+	case 1:
+		return toTime(reflect.ValueOf(args[0]), time.Now())
+	case 3, 6:
+		elems := make([]reflect.Value, len(args))
+		for i, a := range args {
+			elems[i] = reflect.ValueOf(a)
+		}
+		return fieldsTime(elems)
+	}
+	panic("fstime takes 1, 2, 3 or 6 arguments")
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func doy(t interface{}) int {
+	return toTime(reflect.ValueOf(t), time.Now()).UTC().YearDay()
+}
+
+func unix(t interface{}) float64 {
+	return float64(toTime(reflect.ValueOf(t), time.Now()).UnixNano()) / 1e9
+}
+
+func mjd(t interface{}) float64 {
+	return unix(t)/86400 + mjdUnix
+}
+
+func rfc3339(t interface{}) string {
+	return toTime(reflect.ValueOf(t), time.Now()).UTC().Format(time.RFC3339Nano)
+}
+
+func since(t interface{}) float64 {
+	return time.Since(toTime(reflect.ValueOf(t), time.Now())).Seconds()
+}
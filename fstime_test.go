@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestFSTime(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `rfc3339("2026.289.12:00:01.23")`, want: `"2026-10-16T12:00:01.23Z"`},
+		{src: `rfc3339("2026-10-16T12:00:01Z")`, want: `"2026-10-16T12:00:01Z"`},
+		{src: `rfc3339(fs.time)`, want: `"2026-10-16T12:00:01.23Z"`},
+		{src: `rfc3339(fstime(23, 1, 0, 12, 289, 2026))`, want: `"2026-10-16T12:00:01.23Z"`},
+		{src: `rfc3339(fstime(2026, 289, 43201.5))`, want: `"2026-10-16T12:00:01.5Z"`},
+		{src: `rfc3339(1e9)`, want: `"2001-09-09T01:46:40Z"`},
+		{src: `rfc3339(fstime(1e9))`, want: `"2001-09-09T01:46:40Z"`},
+
+		{src: `rfc3339(fstime(150, "sec"))`, want: `"1970-01-01T00:02:30Z"`},
+		{src: `rfc3339(fstime(150, "centisec"))`, want: `"1970-01-01T00:00:01.5Z"`},
+		{src: `rfc3339(fstime(177780000123, "centisec"))`, want: `"2026-05-03T09:20:01.23Z"`},
+		{src: `rfc3339(fstime(1.5, "sec", "2026.289.12:00:00"))`, want: `"2026-10-16T12:00:01.5Z"`},
+		{src: `fstime(1, "min")`, err: `unknown time unit "min"`},
+		{src: `fstime(1, 2, 3, 4)`, err: "fstime takes 1, 2, 3 or 6 arguments"},
+		{src: `fstime(1, 2, 3, 4, 5)`, err: "fstime takes 1, 2, 3 or 6 arguments"},
+		{src: `fstime(fs.bbc[0].bw)`, err: "can't make a time from 2 numbers"},
+
+		{src: `doy("2026.289.12:00:00")`, want: "289"},
+		{src: `doy("2024-12-31T23:59:59Z")`, want: "366"},
+		{src: `mjd("1970-01-01T00:00:00Z")`, want: "40587"},
+		{src: `mjd("2026-10-16T12:00:00Z")`, want: "61329.5"},
+		{src: `unix("1970-01-01T00:00:01.5Z")`, want: "1.5"},
+		{src: `unix(fstime(1.5, "sec"))`, want: "1.5"},
+		{src: `since(now()) < 1`, want: "true"},
+		{src: `since("2026.289.12:00:00") > 0`, want: "true"},
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+//go:generate sh -c "go run fscomdoc.go -o fielddoc.go /usr2/fs/include/*.h"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A builtin is a global function, documented for help()
+type builtin struct {
+	name string
+	fn   interface{} // nil if the interpreter defines it
+	sig  string
+	doc  string
+}
+
+var builtins []builtin
+
+func init() {
+	builtins = []builtin{
+		{"ls", nil, "ls([x...])", "names of the fields, methods and keys of x, or of the globals"},
+		{"str", cstr, "str(s)", "C string s as a string"},
+		{"help", special(help), "help([x])", "list builtins, or describe x"},
+		{"fslog", special(fslog), "fslog(x[, name])", "x formatted as an FS log line"},
+		{"enum", special(enumOf), "enum(x[, path])", "names of the codes in field x, from the enum of its path or path"},
+		{"byname", special(byname), "byname(xs, field, value)", "the element of array xs whose field is value"},
+		{"describe", describe, "describe(x[, depth])", "print the type structure of x, with values, to depth levels"},
+	}
+	builtins = append(builtins, mathBuiltins...)
+	builtins = append(builtins, stringBuiltins...)
+	builtins = append(builtins, timeBuiltins...)
+	builtins = append(builtins, astroBuiltins...)
+	builtins = append(builtins, bitBuiltins...)
+	builtins = append(builtins, selBuiltins...)
+	builtins = append(builtins, searchBuiltins...)
+	builtins = append(builtins, collectionBuiltins...)
+	builtins = append(builtins, queryBuiltins...)
+	builtins = append(builtins, jqBuiltins...)
+}
+
+// register makes the builtins in bs globals of terp
+func register(terp *interpreter, bs []builtin) {
+	for _, b := range bs {
+		if b.fn != nil {
+			terp.Global(keywordIdent(b.name), b.fn)
+		}
+	}
+}
+
+// lookupBuiltin finds the documentation of the builtin name
+func lookupBuiltin(name string) (builtin, bool) {
+	if keywordIdent(strings.TrimPrefix(name, "_")) == name {
+		name = strings.TrimPrefix(name, "_")
+	}
+	for _, bs := range [][]builtin{builtins, logBuiltins} {
+		for _, b := range bs {
+			if b.name == name {
+				return b, true
+			}
+		}
+	}
+	return builtin{}, false
+}
+
+// A fieldNote describes a shared memory field, keyed by its json path
+// without indices, eg "bbc.freq"
+type fieldNote struct {
+	C   string `json:"c"`   // name in fscom.h
+	Doc string `json:"doc"` // description
+}
+
+// stationNotes are the field notes in the user's notes file, loaded on
+// first use
+var stationNotes map[string]fieldNote
+
+// readConfig decodes the JSON file named by the environment variable env,
+// or else fsq/name in the user's config directory, into v. It is not an
+// error for the file not to exist.
+func readConfig(env, name string, v interface{}) error {
+	file := os.Getenv(env)
+	if file == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return err
+		}
+		file = filepath.Join(dir, "fsq", name)
+	}
+
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return nil
+}
+
+func loadNotes() error {
+	if stationNotes != nil {
+		return nil
+	}
+	stationNotes = make(map[string]fieldNote)
+	return readConfig("FSQ_NOTES", "notes.json", &stationNotes)
+}
+
+// help(x) describes the builtin or value x, or with no argument lists the
+// builtins
+func help(terp *interpreter, args []ast.Expr) reflect.Value {
+	switch len(args) {
+	case 0:
+		helpBuiltins(terp)
+	case 1:
+		helpExpr(terp, args[0])
+	default:
+		panic("help takes at most one argument")
+	}
+	return reflect.Value{}
+}
+
+func helpBuiltins(terp *interpreter) {
+	var bs []builtin
+	for name := range terp.globals {
+		if b, ok := lookupBuiltin(name); ok {
+			bs = append(bs, b)
+		}
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].name < bs[j].name })
+
+	fmt.Println("Builtins:")
+	for _, b := range bs {
+		fmt.Printf("  %-26s %s\n", b.sig, b.doc)
+	}
+	fmt.Println()
+	fmt.Println("help(x) describes x, eg help(fs.lsorna). In a session, :help lists commands.")
+}
+
+func helpExpr(terp *interpreter, exp ast.Expr) {
+	if ident, ok := exp.(*ast.Ident); ok {
+		if b, ok := lookupBuiltin(ident.Name); ok {
+			fmt.Printf("%s\n  %s\n", b.sig, b.doc)
+			return
+		}
+		if src, ok := terp.defs[ident.Name]; ok {
+			fmt.Printf("%s = %s\n", ident.Name, src)
+		}
+	}
+
+	v := terp.eval(exp)
+	if !v.IsValid() {
+		fmt.Println(expfmt(exp), "has no value")
+		return
+	}
+	t := v.Type()
+	if v.Kind() == reflect.Ptr && t.Elem().Kind() != reflect.Func {
+		t = t.Elem()
+	}
+
+	fmt.Println(expfmt(exp))
+	fmt.Printf("  type:    %s\n", t)
+	fmt.Printf("  size:    %d bytes\n", t.Size())
+
+	sel, ok := exp.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	parent := terp.eval(sel.X).Type()
+	for parent.Kind() == reflect.Ptr {
+		parent = parent.Elem()
+	}
+	if parent.Kind() != reflect.Struct {
+		return
+	}
+	field, ok := structField(parent, terp.Tag, sel.Sel.Name)
+	if !ok {
+		return
+	}
+
+	path := strings.Join(fieldPath(exp), ".")
+	note := fieldDocs[path]
+
+	fmt.Printf("  offset:  %d in %s\n", field.Offset, parent)
+	fmt.Printf("  Go:      %s\n", field.Name)
+	if name, ok := tagName(field, "json"); ok {
+		fmt.Printf("  json:    %s\n", name)
+	}
+	if note.C != "" {
+		fmt.Printf("  C:       %s\n", note.C)
+	}
+	if note.Doc != "" {
+		fmt.Printf("  about:   %s\n", note.Doc)
+	}
+
+	if err := loadNotes(); err != nil {
+		fmt.Println("  error loading notes:", err)
+	}
+	if local, ok := stationNotes[path]; ok && local.Doc != "" {
+		fmt.Printf("  note:    %s\n", local.Doc)
+	}
+}
+
+// fieldPath is the path of field names selected by exp, without its root
+// and indices, eg [bbc freq] for fs.bbc[1].freq
+func fieldPath(exp ast.Expr) []string {
+	switch e := exp.(type) {
+	case *ast.SelectorExpr:
+		return append(fieldPath(e.X), e.Sel.Name)
+	case *ast.IndexExpr:
+		return fieldPath(e.X)
+	case *ast.SliceExpr:
+		return fieldPath(e.X)
+	case *ast.ParenExpr:
+		return fieldPath(e.X)
+	}
+	return nil
+}
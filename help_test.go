@@ -0,0 +1,70 @@
+package main
+
+import (
+	"go/parser"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// capture returns what fn writes to f, os.Stdout or os.Stderr
+func capture(t *testing.T, f **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := *f
+	*f = w
+	defer func() { *f = old }()
+
+	fn()
+	w.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestHelpField(t *testing.T) {
+	t.Setenv("FSQ_NOTES", os.DevNull)
+	terp := testInterp()
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"fs.equip.rack", []string{"json:    rack", "C:       rack", "about:   rack type"}},
+		{"fs.lsorna", []string{"C:       lsorna", "about:   source name"}},
+		{"fs.bbc[1].freq", []string{"json:    freq"}},
+	}
+	for _, tt := range tests {
+		exp, err := parser.ParseExpr(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := capture(t, &os.Stdout, func() { helpExpr(terp, exp) })
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("help(%s) = %q, want it to contain %q", tt.src, got, want)
+			}
+		}
+	}
+}
+
+func TestFieldDocsKeys(t *testing.T) {
+	for _, src := range []string{"fs.equip.rack", "fs.bbc[0].freq", "(fs.lsorna)"} {
+		exp, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := strings.Join(fieldPath(exp), ".")
+		if strings.ContainsAny(path, "[]()") || strings.HasPrefix(path, "fs") {
+			t.Errorf("fieldPath(%s) = %q, want a json path without root or indices", src, path)
+		}
+	}
+	if note := fieldDocs["equip.rack"]; note.C != "rack" || note.Doc != "rack type" {
+		t.Errorf(`fieldDocs["equip.rack"] = %+v`, note)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// historySize is the most entries kept in the history file
+const historySize = 1000
+
+// A history is the list of lines entered in sessions, persisted to a file
+// shared by all the user's sessions. The file is locked while it is
+// changed, so concurrent sessions don't clobber each other.
+type history struct {
+	path    string
+	entries []string
+}
+
+// historyPath is fsq/history in $XDG_STATE_HOME, or ~/.local/state
+func historyPath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "fsq", "history"), nil
+}
+
+func newHistory(path string) (*history, error) {
+	h := &history{path: path}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return h, err
+	}
+	unlock, err := h.lock()
+	if err != nil {
+		return h, err
+	}
+	defer unlock()
+
+	h.entries, err = h.read()
+	return h, err
+}
+
+// lock takes an exclusive lock on the history file
+func (h *history) lock() (unlock func(), err error) {
+	f, err := os.OpenFile(h.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// read reads the history file, with duplicates and old entries removed
+func (h *history) read() ([]string, error) {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	return dedup(entries), scanner.Err()
+}
+
+// dedup removes all but the last of any repeated entries, and all but the
+// latest historySize entries
+func dedup(entries []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for i := len(entries) - 1; i >= 0 && len(out) < historySize; i-- {
+		e := entries[i]
+		if strings.TrimSpace(e) == "" || seen[e] {
+			continue
+		}
+		seen[e] = true
+		out = append(out, e)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// add appends line to the history and the history file
+func (h *history) add(line string) error {
+	h.entries = dedup(append(h.entries, line))
+
+	unlock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, line)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// compact rewrites the history file without duplicates or old entries,
+// keeping entries added by other sessions
+func (h *history) compact() error {
+	unlock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := h.read()
+	if err != nil {
+		return err
+	}
+
+	tmp := h.path + ".tmp"
+	err = os.WriteFile(tmp, []byte(strings.Join(append(entries, ""), "\n")), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// search returns the numbers of the entries containing pattern, starting
+// from 1
+func (h *history) search(pattern string) []int {
+	var found []int
+	for i, e := range h.entries {
+		if strings.Contains(e, pattern) {
+			found = append(found, i+1)
+		}
+	}
+	return found
+}
+
+// get returns entry n, as numbered by search
+func (h *history) get(arg string) (string, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(h.entries) {
+		return "", fmt.Errorf("no history entry %q", arg)
+	}
+	return h.entries[n-1], nil
+}
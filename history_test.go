@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	many := make([]string, historySize+10)
+	for i := range many {
+		many[i] = strconv.Itoa(i)
+	}
+
+	tests := []struct {
+		entries []string
+		want    []string
+	}{
+		{nil, nil},
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{[]string{"a", "b", "a"}, []string{"b", "a"}},
+		{[]string{"a", "a", "a"}, []string{"a"}},
+		{[]string{"a", "", "  ", "b"}, []string{"a", "b"}},
+		{many, many[10:]},
+	}
+	for _, tt := range tests {
+		if got := dedup(tt.entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dedup(%q) = %q, want %q", tt.entries, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	if p, err := historyPath(); err != nil || p != "/state/fsq/history" {
+		t.Errorf("historyPath() = %q, %v", p, err)
+	}
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("HOME", "/home/oper")
+	if p, err := historyPath(); err != nil || p != "/home/oper/.local/state/fsq/history" {
+		t.Errorf("historyPath() = %q, %v", p, err)
+	}
+}
+
+func TestHistoryShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsq", "history")
+	a, err := newHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, add := range []struct {
+		h    *history
+		line string
+	}{{a, "fs.lsorna"}, {b, "fs.bbc"}, {a, "fs.bbc"}, {b, "now()"}} {
+		if err := add.h.add(add.line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"fs.lsorna", "fs.bbc"}; !reflect.DeepEqual(a.entries, want) {
+		t.Errorf("a.entries = %q, want %q", a.entries, want)
+	}
+
+	if err := a.compact(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fs.lsorna", "fs.bbc", "now()"}
+	if !reflect.DeepEqual(c.entries, want) {
+		t.Errorf("after compact, entries = %q, want %q", c.entries, want)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "fs.lsorna\nfs.bbc\nnow()\n" {
+		t.Errorf("compacted file = %q", b)
+	}
+
+	if got := c.search("fs."); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("search(fs.) = %v", got)
+	}
+	if e, err := c.get("3"); err != nil || e != "now()" {
+		t.Errorf("get(3) = %q, %v", e, err)
+	}
+	for _, n := range []string{"0", "4", "x"} {
+		if _, err := c.get(n); err == nil {
+			t.Errorf("get(%s): no error", n)
+		}
+	}
+}
+
+func TestHistoryConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	const sessions, lines = 8, 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		h, err := newHistory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int, h *history) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				if err := h.add(fmt.Sprintf("s%d l%d", i, j)); err != nil {
+					t.Error(err)
+				}
+				if j%5 == 0 {
+					if err := h.compact(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(i, h)
+	}
+	wg.Wait()
+
+	h, err := newHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.entries) != sessions*lines {
+		t.Errorf("%d entries, want %d", len(h.entries), sessions*lines)
+	}
+}
+
+func TestHistoryLock(t *testing.T) {
+	h := &history{path: filepath.Join(t.TempDir(), "history")}
+	unlock, err := h.lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan bool)
+	go func() {
+		unlock, err := h.lock()
+		if err != nil {
+			t.Error(err)
+			close(locked)
+			return
+		}
+		unlock()
+		locked <- true
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("took the lock while it was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not taken after it was released")
+	}
+}
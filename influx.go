@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encodeInflux writes v as a line of InfluxDB line protocol, with the
+// measurement named after the expression label.
+func encodeInflux(w io.Writer, label string, v reflect.Value) error {
+	line, err := influxLine(labelName(label), v, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", line)
+	return err
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxLine renders v as line protocol. Leaves of v are named by their json
+// path joined with '_'. C strings become tags and everything else numeric,
+// boolean or string becomes a field, with unsigned integers as unsigned. NaN and infinite values are omitted as
+// InfluxDB can't store them.
+func influxLine(measurement string, v reflect.Value, t time.Time) ([]byte, error) {
+	var tags, fields []string
+
+	walk(v, "json", nil, func(path []string, v reflect.Value) {
+		key := strings.Join(path, "_")
+		if key == "" {
+			key = "value"
+		}
+		key = keyEscaper.Replace(key)
+
+		if v.CanInterface() {
+			v = constDemote(v)
+		}
+
+		if isCString(v.Type()) {
+			s := cstr(v.Interface())
+			if s != "" {
+				tags = append(tags, key+"="+keyEscaper.Replace(s))
+			}
+			return
+		}
+
+		var val string
+		switch {
+		case v.Kind() == reflect.Bool:
+			val = strconv.FormatBool(v.Bool())
+		case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+			val = strconv.FormatInt(v.Int(), 10) + "i"
+		case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+			val = strconv.FormatUint(v.Uint(), 10) + "u"
+		case isFloat(v):
+			f := v.Float()
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return
+			}
+			val = strconv.FormatFloat(f, 'g', -1, v.Type().Bits())
+		case v.Kind() == reflect.String:
+			val = `"` + stringEscaper.Replace(v.String()) + `"`
+		case v.Type() == timeType:
+			val = `"` + v.Interface().(time.Time).UTC().Format(time.RFC3339Nano) + `"`
+		default:
+			return
+		}
+		fields = append(fields, key+"="+val)
+	})
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields in value for measurement %q", measurement)
+	}
+
+	sort.Strings(tags)
+
+	var buf bytes.Buffer
+	buf.WriteString(measurementEscaper.Replace(measurement))
+	for _, tag := range tags {
+		buf.WriteByte(',')
+		buf.WriteString(tag)
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strings.Join(fields, ","))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	return buf.Bytes(), nil
+}
+
+// A pusher buffers lines of line protocol and writes them in batches to an
+// InfluxDB HTTP write endpoint.
+type pusher struct {
+	URL     string
+	Client  *http.Client
+	Batch   int           // maximum lines per write
+	Buffer  int           // maximum lines held while the server is unavailable
+	Retries int           // attempts made for each batch per flush
+	Backoff time.Duration // wait before the first retry, doubled for each after
+
+	lines [][]byte
+}
+
+// errRejected is returned when the server refuses a batch. Retrying it
+// will not help.
+var errRejected = errors.New("batch rejected")
+
+func (p *pusher) add(line []byte) {
+	p.lines = append(p.lines, line)
+	if over := len(p.lines) - p.Buffer; p.Buffer > 0 && over > 0 {
+		fmt.Fprintf(os.Stderr, "push: buffer full, dropping %d lines\n", over)
+		p.lines = p.lines[over:]
+	}
+}
+
+// flush writes all buffered lines. Lines that could not be written are kept
+// for the next flush, unless the server rejected them.
+func (p *pusher) flush() error {
+	for len(p.lines) > 0 {
+		n := len(p.lines)
+		if p.Batch > 0 && n > p.Batch {
+			n = p.Batch
+		}
+		err := p.write(bytes.Join(p.lines[:n], []byte("\n")))
+		if err != nil && !errors.Is(err, errRejected) {
+			return err
+		}
+		p.lines = p.lines[n:]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pusher) write(body []byte) (err error) {
+	backoff := p.Backoff
+	for attempt := 0; attempt < p.Retries || attempt == 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = p.post(body)
+		if err == nil || errors.Is(err, errRejected) {
+			return err
+		}
+	}
+	return err
+}
+
+func (p *pusher) post(body []byte) error {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(p.URL, "text/plain; charset=utf-8", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		err = fmt.Errorf("%w: %s", errRejected, err)
+	}
+	return err
+}
+
+func pushMain(args []string) {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+	url := flags.String("influx", "", "InfluxDB write `url`, eg http://localhost:8086/write?db=fs")
+	interval := flags.Duration("interval", 10*time.Second, "sampling `interval`")
+	measurement := flags.String("measurement", "", "measurement `name` (default from each expression)")
+	batch := flags.Int("batch", 1000, "maximum `lines` per write")
+	buffer := flags.Int("buffer", 100000, "maximum `lines` held while InfluxDB is unavailable")
+	retries := flags.Int("retries", 3, "write `attempts` per batch each interval")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsq push -influx url [flags] expression...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *url == "" || flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	terp := setup()
+	p := &pusher{
+		URL:     *url,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		Batch:   *batch,
+		Buffer:  *buffer,
+		Retries: *retries,
+		Backoff: time.Second,
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		for _, src := range flags.Args() {
+			v, err := terp.Eval(src)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "push: %s: %s\n", src, err)
+				continue
+			}
+
+			name := *measurement
+			if name == "" {
+				name = labelName(src)
+			}
+			line, err := influxLine(name, v, now)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "push: %s: %s\n", src, err)
+				continue
+			}
+			p.add(line)
+		}
+
+		if err := p.flush(); err != nil {
+			fmt.Fprintln(os.Stderr, "push:", err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	v := struct {
+		Source [8]byte `json:"source"`
+		Freq   float64 `json:"freq"`
+		Bw     [2]int  `json:"bw"`
+		Note   string  `json:"note"`
+		Status uint64  `json:"status"`
+	}{Freq: 100.5, Bw: [2]int{4, 8}, Note: `a "b"`, Status: math.MaxUint64}
+	copy(v.Source[:], "3C84")
+
+	line, err := influxLine("bbc 1", reflect.ValueOf(v), time.Unix(1, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `bbc\ 1,source=3C84 freq=100.5,bw_0=4i,bw_1=8i,note="a \"b\"",status=18446744073709551615u 1000000005`
+	if string(line) != want {
+		t.Errorf("got  %s\nwant %s", line, want)
+	}
+}
+
+// influxServer answers writes with the status codes in codes, in turn, and
+// then 204, recording the bodies of the requests
+func influxServer(t *testing.T, codes ...int) (*httptest.Server, *[]string) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		code := http.StatusNoContent
+		if len(codes) > 0 {
+			code, codes = codes[0], codes[1:]
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &bodies
+}
+
+func TestPusherBatches(t *testing.T) {
+	srv, bodies := influxServer(t)
+	p := &pusher{URL: srv.URL, Batch: 2, Retries: 1}
+	for _, l := range []string{"m a=1i 1", "m a=2i 2", "m a=3i 3"} {
+		p.add([]byte(l))
+	}
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"m a=1i 1\nm a=2i 2", "m a=3i 3"}
+	if !reflect.DeepEqual(*bodies, want) {
+		t.Errorf("got bodies %q, want %q", *bodies, want)
+	}
+	if len(p.lines) != 0 {
+		t.Errorf("%d lines left after flush", len(p.lines))
+	}
+}
+
+func TestPusherRetries(t *testing.T) {
+	srv, bodies := influxServer(t, http.StatusServiceUnavailable)
+	p := &pusher{URL: srv.URL, Retries: 2, Backoff: time.Millisecond}
+	p.add([]byte("m a=1i 1"))
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*bodies) != 2 || (*bodies)[1] != "m a=1i 1" {
+		t.Errorf("got bodies %q, want the line written twice", *bodies)
+	}
+
+	// out of attempts: the line is kept for the next flush
+	srv, bodies = influxServer(t, http.StatusInternalServerError, http.StatusInternalServerError)
+	p = &pusher{URL: srv.URL, Retries: 2, Backoff: time.Millisecond}
+	p.add([]byte("m a=1i 1"))
+	if err := p.flush(); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("flush: got %v, want a 500 error", err)
+	}
+	if len(p.lines) != 1 {
+		t.Fatalf("%d lines kept after failure, want 1", len(p.lines))
+	}
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*bodies) != 3 || len(p.lines) != 0 {
+		t.Errorf("got bodies %q and %d lines left", *bodies, len(p.lines))
+	}
+}
+
+func TestPusherRejected(t *testing.T) {
+	srv, bodies := influxServer(t, http.StatusBadRequest)
+	p := &pusher{URL: srv.URL, Retries: 3, Backoff: time.Millisecond}
+	p.add([]byte("m a=bad 1"))
+	if err := p.flush(); err == nil {
+		t.Fatal("flush: got no error for a rejected batch")
+	}
+	if len(*bodies) != 1 || len(p.lines) != 0 {
+		t.Errorf("rejected batch: %d writes and %d lines kept, want 1 and 0", len(*bodies), len(p.lines))
+	}
+}
+
+func TestPusherBufferBounded(t *testing.T) {
+	srv, bodies := influxServer(t)
+	p := &pusher{URL: srv.URL, Buffer: 3, Retries: 1}
+	for _, l := range []string{"m a=1i 1", "m a=2i 2", "m a=3i 3", "m a=4i 4", "m a=5i 5"} {
+		p.add([]byte(l))
+	}
+	if len(p.lines) != 3 {
+		t.Fatalf("buffer holds %d lines, want 3", len(p.lines))
+	}
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"m a=3i 3\nm a=4i 4\nm a=5i 5"}
+	if !reflect.DeepEqual(*bodies, want) {
+		t.Errorf("got bodies %q, want the newest lines %q", *bodies, want)
+	}
+}
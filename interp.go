@@ -7,6 +7,7 @@ import (
 	"go/constant"
 	"go/format"
 	"go/parser"
+	"go/scanner"
 	"go/token"
 	"reflect"
 	"runtime"
@@ -26,20 +27,41 @@ func expfmt(node interface{}) string {
 	return buf.String()
 }
 
+// tagName returns the name given to field by the struct tag key tag
+func tagName(field reflect.StructField, tag string) (string, bool) {
+	s, ok := field.Tag.Lookup(tag)
+	if !ok {
+		return "", false
+	}
+	if idx := strings.Index(s, ","); idx != -1 {
+		s = s[:idx]
+	}
+	return s, true
+}
+
+// structField finds the field of struct type t named name, by the struct tag
+// key tag if given, or else by its Go name
+func structField(t reflect.Type, tag, name string) (reflect.StructField, bool) {
+	if tag != "" {
+		for i := 0; i < t.NumField(); i++ {
+			if s, ok := tagName(t.Field(i), tag); ok && s == name {
+				return t.Field(i), true
+			}
+		}
+	}
+	return t.FieldByName(name)
+}
+
 func fieldByTagName(v reflect.Value, tag, name string) reflect.Value {
 	if v.Kind() != reflect.Struct {
 		panic("fieldByTagName called on non-struct value")
 	}
 
 	for i := 0; i < v.NumField(); i++ {
-		field := v.Type().Field(i)
-		s, ok := field.Tag.Lookup(tag)
+		s, ok := tagName(v.Type().Field(i), tag)
 		if !ok {
 			continue
 		}
-		if idx := strings.Index(s, ","); idx != -1 {
-			s = s[:idx]
-		}
 		if s == name {
 			return v.Field(i)
 		}
@@ -47,14 +69,27 @@ func fieldByTagName(v reflect.Value, tag, name string) reflect.Value {
 	return reflect.Value{}
 }
 
+// A special is a builtin passed its arguments unevaluated, for builtins that
+// need more than the argument values, such as their names.
+type special func(terp *interpreter, args []ast.Expr) reflect.Value
+
 type interpreter struct {
 	globals map[string]reflect.Value
 	Tag     string
+
+	// local scopes in view, innermost last: those of the user function
+	// being called, and of the functions it was defined in
+	locals []map[string]reflect.Value
+
+	// source of user definitions by label, and the order they were made
+	defs  map[string]string
+	order []string
 }
 
 func NewInterpreter() *interpreter {
 	terp := &interpreter{
 		globals: make(map[string]reflect.Value),
+		defs:    make(map[string]string),
 	}
 	// Useful builtin functions, that can interact with the interpreter
 	terp.globals["ls"] = reflect.ValueOf(func(ins ...interface{}) []string {
@@ -82,14 +117,11 @@ func NewInterpreter() *interpreter {
 					field := v.Type().Field(i)
 					name := field.Name
 					if terp.Tag != "" {
-						s, ok := field.Tag.Lookup(terp.Tag)
+						s, ok := tagName(field, terp.Tag)
 						if !ok {
 							continue
 						}
 						name = s
-						if idx := strings.Index(s, ","); idx != -1 {
-							name = s[:idx]
-						}
 					}
 					children = append(children, name)
 				}
@@ -111,17 +143,22 @@ func (terp *interpreter) Global(label string, value interface{}) {
 	terp.globals[strings.TrimSpace(label)] = v
 }
 
+// panicError is the error for the value r recovered from a panic in
+// evaluation. Runtime errors are bugs, so panic again.
+func panicError(r interface{}) error {
+	switch r := r.(type) {
+	case runtime.Error:
+		panic(r)
+	case error:
+		return r
+	}
+	return fmt.Errorf("%s", r)
+}
+
 func (terp *interpreter) Eval(line string) (value reflect.Value, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			switch r := r.(type) {
-			case runtime.Error:
-				panic(r)
-			case error:
-				err = r
-			default:
-				err = fmt.Errorf("%s", r)
-			}
+			err = panicError(r)
 		}
 	}()
 
@@ -133,19 +170,21 @@ func (terp *interpreter) Eval(line string) (value reflect.Value, err error) {
 		return reflect.ValueOf(terp.globals), nil
 	}
 
-	if strings.ContainsRune(line, '=') {
-		fields := strings.Split(line, "=")
-		if len(fields) > 2 {
-			err = fmt.Errorf("multiple assignment not supported")
+	if label, src, ok := assignment(line); ok {
+		if !token.IsIdentifier(label) {
+			err = fmt.Errorf("cannot assign to %q", label)
 			return
 		}
 
-		label := strings.TrimSpace(fields[0])
-		exp, err = parser.ParseExpr(fields[1])
+		exp, err = parseExpr(src)
 		if err != nil {
 			return
 		}
 		terp.globals[label] = terp.eval(exp)
+		if _, ok := terp.defs[label]; !ok {
+			terp.order = append(terp.order, label)
+		}
+		terp.defs[label] = strings.TrimSpace(src)
 		return reflect.Value{}, nil
 	}
 
@@ -153,7 +192,7 @@ func (terp *interpreter) Eval(line string) (value reflect.Value, err error) {
 		return v, nil
 	}
 
-	exp, err = parser.ParseExpr(line)
+	exp, err = parseExpr(line)
 	if err != nil {
 		return reflect.Value{}, err
 	}
@@ -161,6 +200,89 @@ func (terp *interpreter) Eval(line string) (value reflect.Value, err error) {
 	return value, err
 }
 
+// parseExpr parses the expression src. Builtins named by Go keywords, such
+// as map, are first changed to their global names.
+func parseExpr(src string) (ast.Expr, error) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, 0)
+
+	var b strings.Builder
+	var last token.Token
+	prev, lastOff := 0, 0
+	for {
+		pos, tok, _ := s.Scan()
+		if last == token.MAP && tok != token.LBRACK {
+			// map is the builtin unless it starts a map type
+			b.WriteString(src[prev:lastOff])
+			b.WriteString(keywordIdent("map"))
+			prev = lastOff + len("map")
+		}
+		if tok == token.EOF {
+			break
+		}
+		last, lastOff = tok, file.Offset(pos)
+	}
+	b.WriteString(src[prev:])
+	return parser.ParseExpr(b.String())
+}
+
+// keywordIdent is the global name of the builtin name, which differs from
+// name if it is a Go keyword
+func keywordIdent(name string) string {
+	if token.IsKeyword(name) {
+		return "_" + name
+	}
+	return name
+}
+
+// userName is the global name as it is written, without the prefix
+// keywordIdent gives keywords
+func userName(name string) string {
+	if s := strings.TrimPrefix(name, "_"); s != name && keywordIdent(s) == name {
+		return s
+	}
+	return name
+}
+
+// assignment splits line into label and expression if it is an assignment
+// "label = expression"
+func assignment(line string) (label, src string, ok bool) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(line))
+	var s scanner.Scanner
+	s.Init(file, []byte(line), nil, 0)
+
+	depth := 0
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return "", "", false
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.ASSIGN, token.DEFINE:
+			if depth == 0 {
+				i := file.Offset(pos)
+				return strings.TrimSpace(line[:i]), line[i+len(tok.String()):], true
+			}
+		}
+	}
+}
+
+// Definitions gives the user definitions, in the order they were made, as
+// statements that would remake them
+func (terp *interpreter) Definitions() []string {
+	defs := make([]string, len(terp.order))
+	for i, label := range terp.order {
+		defs[i] = label + " = " + terp.defs[label]
+	}
+	return defs
+}
+
 // This guy does the actual work
 func (terp *interpreter) eval(exp ast.Expr) reflect.Value {
 	if exp == nil {
@@ -168,6 +290,11 @@ func (terp *interpreter) eval(exp ast.Expr) reflect.Value {
 	}
 	switch exp := exp.(type) {
 	case *ast.Ident:
+		for i := len(terp.locals) - 1; i >= 0; i-- {
+			if v, ok := terp.locals[i][exp.Name]; ok {
+				return v
+			}
+		}
 		if v, ok := terp.globals[exp.String()]; ok {
 			return v
 		}
@@ -186,19 +313,19 @@ func (terp *interpreter) eval(exp ast.Expr) reflect.Value {
 			recvr = reflect.Indirect(recvr)
 		}
 
+		if recvr.Kind() == reflect.Array || recvr.Kind() == reflect.Slice {
+			return terp.eachField(recvr, s)
+		}
 		if recvr.Kind() != reflect.Struct {
 			panic(fmt.Errorf("select field %q from type %q", s, recvr.Kind()))
 		}
 
-		if terp.Tag != "" {
-			f = fieldByTagName(recvr, terp.Tag, s)
-			if f.IsValid() {
-				return f.Addr()
-			}
-		}
-
-		f = recvr.FieldByName(s)
+		f = terp.field(recvr, s)
 		if f.IsValid() {
+			if !f.CanAddr() {
+				// a field of a returned struct
+				return f
+			}
 			return f.Addr()
 		}
 
@@ -210,7 +337,26 @@ func (terp *interpreter) eval(exp ast.Expr) reflect.Value {
 			recvr = reflect.Indirect(recvr)
 		}
 
-		return recvr.Index(index(terp.eval(exp.Index))).Addr()
+		if recvr.Kind() == reflect.Map {
+			key := argument(constDemote(terp.eval(exp.Index)), recvr.Type().Key())
+			v := recvr.MapIndex(key)
+			if !v.IsValid() {
+				panic(fmt.Errorf("%s has no key %v", expfmt(exp.X), key))
+			}
+			return v
+		}
+
+		i := terp.eval(exp.Index)
+		if keyed(recvr) && isStrings(i) {
+			// element by key, as in fs.flux["3C84"]
+			return terp.byKey(recvr, keyField(recvr, fieldPath(exp.X)), text(i))
+		}
+
+		v := recvr.Index(index(i))
+		if !v.CanAddr() {
+			return v
+		}
+		return v.Addr()
 
 	case *ast.SliceExpr:
 		recvr := terp.eval(exp.X)
@@ -244,49 +390,392 @@ func (terp *interpreter) eval(exp ast.Expr) reflect.Value {
 		return reflect.ValueOf(con)
 
 	case *ast.BinaryExpr:
-		x := constPromote(terp.eval(exp.X))
-		y := constPromote(terp.eval(exp.Y))
-
-		return reflect.ValueOf(constant.BinaryOp(x, exp.Op, y))
+		return binaryOp(exp, terp.eval(exp.X), terp.eval(exp.Y))
 
 	case *ast.UnaryExpr:
-		x := constPromote(terp.eval(exp.X))
-		return reflect.ValueOf(constant.UnaryOp(exp.Op, x, 0))
+		return unaryOp(exp, terp.eval(exp.X))
 
 	case *ast.CallExpr:
 		f := terp.eval(exp.Fun)
 
+		if sf, ok := f.Interface().(special); ok {
+			return sf(terp, exp.Args)
+		}
+
 		if f.Kind() != reflect.Func {
 			panic(fmt.Errorf("%s not a function or method", expfmt(exp.Fun)))
 		}
 
 		in := make([]reflect.Value, len(exp.Args))
-
 		for i := range exp.Args {
-			in[i] = constDemote(terp.eval(exp.Args[i]))
+			in[i] = terp.eval(exp.Args[i])
 		}
+		return call(f, in)
 
-		out := f.Call(in)
+	case *ast.ParenExpr:
+		return terp.eval(exp.X)
+
+	case *ast.FuncLit:
+		return terp.funcLit(exp)
+
+	default:
+		panic(fmt.Errorf("unknown type: %s", reflect.TypeOf(exp)))
+	}
+}
+
+// call calls the function f with the arguments in, converted to its
+// parameter types. Multiple results are returned as a slice.
+func call(f reflect.Value, in []reflect.Value) reflect.Value {
+	if _, ok := f.Interface().(special); ok {
+		panic("builtin can only be called directly")
+	}
+	t := f.Type()
+	if len(in) < t.NumIn()-1 || !t.IsVariadic() && len(in) != t.NumIn() {
+		panic(fmt.Errorf("wrong number of arguments to %s: want %d, got %d", t, t.NumIn(), len(in)))
+	}
 
-		if len(out) == 0 {
-			return reflect.Value{}
+	args := make([]reflect.Value, len(in))
+	for i, v := range in {
+		args[i] = argument(constDemote(v), paramType(t, i))
+	}
+
+	out := f.Call(args)
+
+	if len(out) == 0 {
+		return reflect.Value{}
+	}
+	if len(out) == 1 {
+		if out[0].Kind() == reflect.Interface {
+			return out[0].Elem()
 		}
-		if len(out) == 1 {
-			return out[0]
+		return out[0]
+	}
+
+	outiface := make([]interface{}, len(out))
+	for i, ov := range out {
+		outiface[i] = ov.Interface()
+	}
+	return reflect.ValueOf(outiface)
+}
+
+// field returns the field name of the struct v, by tag name or Go name
+func (terp *interpreter) field(v reflect.Value, name string) reflect.Value {
+	var f reflect.Value
+	if terp.Tag != "" {
+		f = fieldByTagName(v, terp.Tag, name)
+	}
+	if !f.IsValid() {
+		f = v.FieldByName(name)
+	}
+	return f
+}
+
+// eachField selects the field name of each element of the array or slice
+// v, giving a slice of the field's type, as in fs.bbc.freq
+func (terp *interpreter) eachField(v reflect.Value, name string) reflect.Value {
+	fields := make([]reflect.Value, v.Len())
+	for i := range fields {
+		e := deref(v.Index(i))
+		var f reflect.Value
+		switch {
+		case !e.IsValid():
+			panic(fmt.Errorf("select field %q from nil", name))
+		case e.Kind() == reflect.Struct:
+			f = terp.field(e, name)
+			if !f.IsValid() {
+				panic(fmt.Errorf("%s has no field %q", e.Type(), name))
+			}
+		case e.Kind() == reflect.Array || e.Kind() == reflect.Slice:
+			f = terp.eachField(e, name)
+		default:
+			panic(fmt.Errorf("select field %q from type %q", name, e.Kind()))
 		}
+		fields[i] = f
+	}
 
-		outiface := make([]interface{}, len(out))
-		for i, ov := range out {
-			outiface[i] = ov.Interface()
+	return sliceOf(fields)
+}
+
+// binaryOp applies the operator of exp to x and y. Arrays and slices are
+// operated on element by element, with scalars applying to each element,
+// and C strings are strings, as in fs.lsorna == "3C84".
+func binaryOp(exp *ast.BinaryExpr, xv, yv reflect.Value) reflect.Value {
+	xv, yv = cstrOperand(xv), cstrOperand(yv)
+	xs, xok := elements(xv)
+	ys, yok := elements(yv)
+	if xok || yok {
+		if xok && yok && len(xs) != len(ys) {
+			panic(fmt.Errorf("lengths %d and %d differ in %s", len(xs), len(ys), expfmt(exp)))
+		}
+		n := len(xs)
+		if !xok {
+			n = len(ys)
 		}
-		return reflect.ValueOf(outiface)
+		out := make([]interface{}, n)
+		for i := range out {
+			a, b := xv, yv
+			if xok {
+				a = xs[i]
+			}
+			if yok {
+				b = ys[i]
+			}
+			out[i] = constDemote(binaryOp(exp, a, b)).Interface()
+		}
+		return reflect.ValueOf(out)
+	}
 
-	case *ast.ParenExpr:
-		return terp.eval(exp.X)
+	x := constPromote(xv)
+	y := constPromote(yv)
+	if notFinite(x, y) || notFinite(y, x) {
+		return floatOp(exp, number(xv), number(yv))
+	}
+	if exp.Op == token.SHL || exp.Op == token.SHR {
+		return shift(exp, x, y)
+	}
+	if !compatible(x, y) {
+		panic(fmt.Errorf("mismatched types %s and %s in %s", x.Kind(), y.Kind(), expfmt(exp)))
+	}
 
-	default:
-		panic(fmt.Errorf("unknown type: %s", reflect.TypeOf(exp)))
+	switch exp.Op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return reflect.ValueOf(constant.MakeBool(constant.Compare(x, exp.Op, y)))
+	}
+	return reflect.ValueOf(constant.BinaryOp(x, exp.Op, y))
+}
+
+// shift shifts the integer x by y bits, the direction of the operator of
+// exp
+func shift(exp *ast.BinaryExpr, x, y constant.Value) reflect.Value {
+	if x.Kind() != constant.Int {
+		panic(fmt.Errorf("shifted operand %s is not an integer in %s", x, expfmt(exp)))
+	}
+	n, ok := constant.Uint64Val(constant.ToInt(y))
+	if !ok {
+		panic(fmt.Errorf("shift count %s is not a non-negative integer in %s", y, expfmt(exp)))
+	}
+	if n > 1024 {
+		panic(fmt.Errorf("shift count %d too large in %s", n, expfmt(exp)))
+	}
+	return reflect.ValueOf(constant.Shift(x, exp.Op, uint(n)))
+}
+
+// notFinite reports if x is a NaN or infinite float, which constants can't
+// hold, and y is a number
+func notFinite(x, y constant.Value) bool {
+	switch y.Kind() {
+	case constant.Unknown, constant.Int, constant.Float:
+		return x.Kind() == constant.Unknown
+	}
+	return false
+}
+
+// floatOp applies the operator of exp to floats, for NaN and infinite
+// operands. Comparisons with NaN are false, except !=, and arithmetic with
+// it is NaN.
+func floatOp(exp *ast.BinaryExpr, x, y float64) reflect.Value {
+	switch exp.Op {
+	case token.EQL:
+		return reflect.ValueOf(x == y)
+	case token.NEQ:
+		return reflect.ValueOf(x != y)
+	case token.LSS:
+		return reflect.ValueOf(x < y)
+	case token.LEQ:
+		return reflect.ValueOf(x <= y)
+	case token.GTR:
+		return reflect.ValueOf(x > y)
+	case token.GEQ:
+		return reflect.ValueOf(x >= y)
+	case token.ADD:
+		return reflect.ValueOf(x + y)
+	case token.SUB:
+		return reflect.ValueOf(x - y)
+	case token.MUL:
+		return reflect.ValueOf(x * y)
+	case token.QUO:
+		return reflect.ValueOf(x / y)
+	}
+	panic(fmt.Errorf("invalid operation %s on floats in %s", exp.Op, expfmt(exp)))
+}
+
+// cstrOperand is v as a string if it is a C string, and otherwise v. FS C
+// strings are blank padded, so trailing blanks are dropped, as by byKey.
+func cstrOperand(v reflect.Value) reflect.Value {
+	if d := deref(v); d.IsValid() && isCString(d.Type()) {
+		return reflect.ValueOf(strings.TrimRight(cstr(d.Interface()), " "))
+	}
+	return v
+}
+
+// unaryOp applies the operator of exp to x, or each element of x
+func unaryOp(exp *ast.UnaryExpr, xv reflect.Value) reflect.Value {
+	if xs, ok := elements(xv); ok {
+		out := make([]interface{}, len(xs))
+		for i, x := range xs {
+			out[i] = constDemote(unaryOp(exp, x)).Interface()
+		}
+		return reflect.ValueOf(out)
+	}
+	x := constPromote(xv)
+	if x.Kind() == constant.Unknown {
+		// NaN or infinite
+		switch exp.Op {
+		case token.ADD:
+			return reflect.ValueOf(number(xv))
+		case token.SUB:
+			return reflect.ValueOf(-number(xv))
+		}
+		panic(fmt.Errorf("invalid operation %s on floats in %s", exp.Op, expfmt(exp)))
+	}
+	return reflect.ValueOf(constant.UnaryOp(exp.Op, x, 0))
+}
+
+// funcLit makes a user function from a function literal. Parameters are
+// untyped, so are named by what Go would take as their type, as in
+// func(x, y) { return x + y }
+func (terp *interpreter) funcLit(lit *ast.FuncLit) reflect.Value {
+	var params []string
+	for _, field := range lit.Type.Params.List {
+		for _, name := range field.Names {
+			params = append(params, name.Name)
+		}
+		if len(field.Names) == 0 {
+			ident, ok := field.Type.(*ast.Ident)
+			if !ok {
+				panic(fmt.Errorf("bad parameter %s", expfmt(field.Type)))
+			}
+			params = append(params, ident.Name)
+		}
+	}
+
+	// the scopes the function is defined in, which it sees when called
+	env := terp.locals[:len(terp.locals):len(terp.locals)]
+
+	fn := func(args ...interface{}) interface{} {
+		if len(args) != len(params) {
+			panic(fmt.Errorf("function takes %d arguments, got %d", len(params), len(args)))
+		}
+
+		scope := make(map[string]reflect.Value, len(params))
+		for i, p := range params {
+			scope[p] = reflect.ValueOf(args[i])
+		}
+		caller := terp.locals
+		terp.locals = append(env, scope)
+		defer func() {
+			terp.locals = caller
+		}()
+
+		v, _ := terp.exec(lit.Body.List)
+		if !v.IsValid() {
+			return nil
+		}
+		return v.Interface()
+	}
+	return reflect.ValueOf(fn)
+}
+
+// assign sets the local name to v. Unless define is set, a name in an
+// enclosing scope is set, as for = in Go.
+func (terp *interpreter) assign(name string, define bool, v reflect.Value) {
+	scope := terp.locals[len(terp.locals)-1]
+	if !define {
+		for i := len(terp.locals) - 1; i >= 0; i-- {
+			if _, ok := terp.locals[i][name]; ok {
+				scope = terp.locals[i]
+				break
+			}
+		}
+	}
+	scope[name] = v
+}
+
+// exec runs the statements of a user function body, returning the value
+// of the return statement reached, if any
+func (terp *interpreter) exec(stmts []ast.Stmt) (reflect.Value, bool) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStmt:
+			if len(stmt.Results) > 1 {
+				panic("multiple return values not supported")
+			}
+			if len(stmt.Results) == 0 {
+				return reflect.Value{}, true
+			}
+			return terp.eval(stmt.Results[0]), true
+
+		case *ast.ExprStmt:
+			terp.eval(stmt.X)
+
+		case *ast.AssignStmt:
+			if len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+				panic("multiple assignment not supported")
+			}
+			ident, ok := stmt.Lhs[0].(*ast.Ident)
+			if !ok || stmt.Tok != token.ASSIGN && stmt.Tok != token.DEFINE {
+				panic(fmt.Errorf("unsupported assignment to %s", expfmt(stmt.Lhs[0])))
+			}
+			terp.assign(ident.Name, stmt.Tok == token.DEFINE, terp.eval(stmt.Rhs[0]))
+
+		case *ast.IfStmt:
+			if stmt.Init != nil {
+				panic("if statement initializers not supported")
+			}
+			if truth(terp.eval(stmt.Cond)) {
+				if v, ok := terp.exec(stmt.Body.List); ok {
+					return v, true
+				}
+			} else if stmt.Else != nil {
+				var v reflect.Value
+				var ok bool
+				switch e := stmt.Else.(type) {
+				case *ast.BlockStmt:
+					v, ok = terp.exec(e.List)
+				default:
+					v, ok = terp.exec([]ast.Stmt{e})
+				}
+				if ok {
+					return v, true
+				}
+			}
+
+		case *ast.BlockStmt:
+			if v, ok := terp.exec(stmt.List); ok {
+				return v, true
+			}
+
+		default:
+			panic(fmt.Errorf("unsupported statement %T", stmt))
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// truth is the boolean value of v
+func truth(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr {
+		v = reflect.Indirect(v)
+	}
+	if v.Kind() == reflect.Bool {
+		return v.Bool()
+	}
+	if c, ok := v.Interface().(constant.Value); ok && c.Kind() == constant.Bool {
+		return constant.BoolVal(c)
 	}
+	panic(fmt.Errorf("non-boolean condition of type %s", v.Type()))
+}
+
+// compatible reports if x and y can be operands of the same operator.
+// go/constant doesn't check, and quietly gives a wrong answer.
+func compatible(x, y constant.Value) bool {
+	numeric := func(k constant.Kind) bool {
+		return k == constant.Int || k == constant.Float || k == constant.Complex
+	}
+	if numeric(x.Kind()) && numeric(y.Kind()) {
+		return true
+	}
+	return x.Kind() == y.Kind() && x.Kind() != constant.Unknown
 }
 
 func isInt(v reflect.Value) bool {
@@ -301,6 +790,40 @@ func isComplex(v reflect.Value) bool {
 	return v.Kind() >= reflect.Complex64 && v.Kind() <= reflect.Complex128
 }
 
+func isNumeric(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Complex128
+}
+
+// paramType is the type of the i'th argument to a function of type t, or
+// nil if there is none
+func paramType(t reflect.Type, i int) reflect.Type {
+	if t.IsVariadic() && i >= t.NumIn()-1 {
+		return t.In(t.NumIn() - 1).Elem()
+	}
+	if i < t.NumIn() {
+		return t.In(i)
+	}
+	return nil
+}
+
+// argument converts v to be passed as a t, dereferencing pointers and
+// converting between numeric types as needed
+func argument(v reflect.Value, t reflect.Type) reflect.Value {
+	if t == nil || !v.IsValid() || v.Type().AssignableTo(t) {
+		return v
+	}
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+		if v.Type().AssignableTo(t) {
+			return v
+		}
+	}
+	if isNumeric(v.Kind()) && isNumeric(t.Kind()) {
+		return v.Convert(t)
+	}
+	return v
+}
+
 func index(v reflect.Value) int {
 	if !v.IsValid() {
 		panic("index called with empty value")
@@ -309,6 +832,9 @@ func index(v reflect.Value) int {
 	for v.Kind() == reflect.Ptr {
 		v = reflect.Indirect(v)
 	}
+	if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+		return int(v.Uint())
+	}
 	if isInt(v) {
 		return int(v.Int())
 	}
@@ -351,14 +877,16 @@ func constDemote(v reflect.Value) reflect.Value {
 }
 
 func constPromote(v reflect.Value) constant.Value {
+	// some constants are pointers
+	if vc, ok := v.Interface().(constant.Value); ok {
+		return vc
+	}
 	for v.Kind() == reflect.Ptr {
 		v = reflect.Indirect(v)
 	}
-	vc, ok := v.Interface().(constant.Value)
-	if ok {
-		return vc
-	}
 	switch {
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		return constant.MakeUint64(v.Uint())
 	case isInt(v):
 		return constant.MakeInt64(v.Int())
 	case isFloat(v):
@@ -366,7 +894,11 @@ func constPromote(v reflect.Value) constant.Value {
 	case isComplex(v):
 		// TODO
 		panic("promoting complex numbers not implemented yet")
+	case v.Kind() == reflect.String:
+		return constant.MakeString(v.String())
+	case v.Kind() == reflect.Bool:
+		return constant.MakeBool(v.Bool())
 	default:
-		panic(fmt.Errorf("unsuported promotion of type %q", v.Kind()))
+		panic(fmt.Errorf("unsupported promotion of type %q", v.Kind()))
 	}
 }
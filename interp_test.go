@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestNaN(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `fs.bbc.tsys > 60`, want: `[false,false,true,false]`},
+		{src: `fs.bbc.tsys <= 100`, want: `[true,true,true,false]`},
+		{src: `fs.bbc.tsys == fs.bbc.tsys`, want: `[true,true,true,false]`},
+		{src: `fs.bbc.tsys != 100`, want: `[true,true,false,true]`},
+		{src: `isnan(fs.bbc.tsys * 2)`, want: `[false,false,false,true]`},
+		{src: `isnan(1 - fs.bbc.tsys)`, want: `[false,false,false,true]`},
+		{src: `isnan(-fs.bbc.tsys)`, want: `[false,false,false,true]`},
+		{src: `-fs.bbc.tsys[1]`, want: `-50`},
+		{src: `fs.bbc[3].tsys % 2`, err: "invalid operation % on floats"},
+		{src: `!fs.bbc[3].tsys`, err: "invalid operation ! on floats"},
+		{src: `fs.bbc[3].tsys + "a"`, err: "mismatched types"},
+	})
+}
+
+func TestCStrings(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `fs.lsorna == "3C84"`, want: `true`},
+		{src: `fs.lsorna != "3C84"`, want: `false`},
+		{src: `fs.bbc[2].name == fs.lsorna`, want: `true`},
+		{src: `fs.bbc.name == "a"`, want: `[true,false,false,false]`},
+		{src: `fs.lsorna + "/" + fs.bbc[0].name`, want: `"3C84/a"`},
+		{src: `fs.lsorna < "3C9"`, want: `true`},
+		{src: `fs.lsorna == 3`, err: "mismatched types String and Int"},
+	})
+}
+
+func TestShift(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `1 << 4`, want: `16`},
+		{src: `fs.iclbox >> 15`, want: `1`},
+		{src: `(fs.iclbox >> 1) & 3`, want: `2`},
+		{src: `fs.bbc.freq >> 2`, want: `[25,50,75,100]`},
+		{src: `1 << fs.bbc[0].bw`, want: `[16,256]`},
+		{src: `-8 >> 1`, want: `-4`},
+		{src: `1 << 2.0`, want: `4`},
+		{src: `1 << -1`, err: "shift count -1 is not a non-negative integer"},
+		{src: `1 << 0.5`, err: "shift count 0.5 is not a non-negative integer"},
+		{src: `1.5 << 1`, err: "shifted operand 1.5 is not an integer"},
+		{src: `1 << 2000`, err: "shift count 2000 too large"},
+	})
+}
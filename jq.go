@@ -0,0 +1,910 @@
+package main
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var jqBuiltins = []builtin{
+	{"jq", jq, "jq(x, filter)", "the result of the jq filter on x, or a list if it gives none or several"},
+}
+
+// jqProgram is the jq filter applied to each result, set by -jq
+var jqProgram string
+
+// A jqFilter gives the outputs of a jq filter for the input v. Values are
+// as in JSON output: fields by json name, C strings as strings, and null
+// as the zero Value.
+type jqFilter func(v reflect.Value) []reflect.Value
+
+// A jqToken is a token of a jq filter
+type jqToken struct {
+	kind string // the punctuation, or "ident", "field", "num", "str", or "" at the end
+	text string
+}
+
+// jqPairs are the two character tokens
+var jqPairs = map[string]bool{"==": true, "!=": true, "<=": true, ">=": true, "//": true}
+
+// jqLex splits src into tokens
+func jqLex(src string) []jqToken {
+	var toks []jqToken
+	isName := func(r byte) bool { return r == '_' || r < utf8.RuneSelf && unicode.IsLetter(rune(r)) }
+	isDigit := func(r byte) bool { return r >= '0' && r <= '9' }
+	name := func(i int) int {
+		for i < len(src) && (isName(src[i]) || isDigit(src[i])) {
+			i++
+		}
+		return i
+	}
+	str := func(i int) (string, int) {
+		j := i + 1
+		for j < len(src) && src[j] != '"' {
+			if src[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(src) {
+			panic("unterminated string in filter")
+		}
+		s, err := strconv.Unquote(src[i : j+1])
+		if err != nil {
+			panic(fmt.Errorf("bad string %s in filter", src[i:j+1]))
+		}
+		return s, j + 1
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '.' && i+1 < len(src) && src[i+1] == '.':
+			toks = append(toks, jqToken{"..", ".."})
+			i += 2
+		case c == '.' && i+1 < len(src) && isName(src[i+1]):
+			j := name(i + 1)
+			toks = append(toks, jqToken{"field", src[i+1 : j]})
+			i = j
+		case c == '.' && i+1 < len(src) && src[i+1] == '"':
+			s, j := str(i + 1)
+			toks = append(toks, jqToken{"field", s})
+			i = j
+		case c == '"':
+			s, j := str(i)
+			toks = append(toks, jqToken{"str", s})
+			i = j
+		case isName(c):
+			j := name(i)
+			toks = append(toks, jqToken{"ident", src[i:j]})
+			i = j
+		case isDigit(c):
+			j := i
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+				j++
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				for j < len(src) && isDigit(src[j]) {
+					j++
+				}
+			}
+			toks = append(toks, jqToken{"num", src[i:j]})
+			i = j
+		case i+1 < len(src) && jqPairs[src[i:i+2]]:
+			toks = append(toks, jqToken{src[i : i+2], src[i : i+2]})
+			i += 2
+		case strings.IndexByte(".|,:[]{}()<>+-*/%", c) != -1:
+			toks = append(toks, jqToken{string(c), string(c)})
+			i++
+		default:
+			panic(fmt.Errorf("unexpected %q in filter", c))
+		}
+	}
+	return toks
+}
+
+// A jqParser parses the tokens of a filter, by recursive descent
+type jqParser struct {
+	toks []jqToken
+	pos  int
+}
+
+func (p *jqParser) peek() jqToken {
+	if p.pos == len(p.toks) {
+		return jqToken{}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *jqParser) next() jqToken {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *jqParser) expect(kind string) {
+	if t := p.next(); t.kind != kind {
+		if t.kind == "" {
+			panic(fmt.Errorf("expected %s at end of filter", kind))
+		}
+		panic(fmt.Errorf("expected %s, found %s in filter", kind, t.text))
+	}
+}
+
+// parseJQ parses the filter src, panicking if it is invalid
+func parseJQ(src string) jqFilter {
+	p := &jqParser{toks: jqLex(src)}
+	if p.peek().kind == "" {
+		return jqIdentity
+	}
+	f := p.pipe()
+	if t := p.peek(); t.kind != "" {
+		panic(fmt.Errorf("unexpected %s in filter", t.text))
+	}
+	return f
+}
+
+func jqIdentity(v reflect.Value) []reflect.Value {
+	return []reflect.Value{v}
+}
+
+// pipe parses f | g | ...
+func (p *jqParser) pipe() jqFilter {
+	f := p.comma()
+	for p.peek().kind == "|" {
+		p.next()
+		f = jqCompose(f, p.comma())
+	}
+	return f
+}
+
+// jqCompose gives the outputs of g for each output of f
+func jqCompose(f, g jqFilter) jqFilter {
+	return func(v reflect.Value) []reflect.Value {
+		var out []reflect.Value
+		for _, x := range f(v) {
+			out = append(out, g(x)...)
+		}
+		return out
+	}
+}
+
+// comma parses f, g, ...
+func (p *jqParser) comma() jqFilter {
+	f := p.alternative()
+	for p.peek().kind == "," {
+		p.next()
+		l, r := f, p.alternative()
+		f = func(v reflect.Value) []reflect.Value {
+			return append(l(v), r(v)...)
+		}
+	}
+	return f
+}
+
+// alternative parses f // g, the outputs of f that aren't false or null,
+// or else those of g
+func (p *jqParser) alternative() jqFilter {
+	f := p.or()
+	for p.peek().kind == "//" {
+		p.next()
+		l, r := f, p.or()
+		f = func(v reflect.Value) []reflect.Value {
+			var out []reflect.Value
+			for _, x := range l(v) {
+				if jqTruth(x) {
+					out = append(out, x)
+				}
+			}
+			if len(out) == 0 {
+				return r(v)
+			}
+			return out
+		}
+	}
+	return f
+}
+
+func (p *jqParser) or() jqFilter {
+	f := p.and()
+	for p.peek().kind == "ident" && p.peek().text == "or" {
+		p.next()
+		f = jqBinary(f, p.and(), func(a, b reflect.Value) reflect.Value {
+			return reflect.ValueOf(jqTruth(a) || jqTruth(b))
+		})
+	}
+	return f
+}
+
+func (p *jqParser) and() jqFilter {
+	f := p.comparison()
+	for p.peek().kind == "ident" && p.peek().text == "and" {
+		p.next()
+		f = jqBinary(f, p.comparison(), func(a, b reflect.Value) reflect.Value {
+			return reflect.ValueOf(jqTruth(a) && jqTruth(b))
+		})
+	}
+	return f
+}
+
+var jqOps = map[string]token.Token{
+	"==": token.EQL, "!=": token.NEQ, "<": token.LSS, "<=": token.LEQ, ">": token.GTR, ">=": token.GEQ,
+	"+": token.ADD, "-": token.SUB, "*": token.MUL, "/": token.QUO, "%": token.REM,
+}
+
+func (p *jqParser) comparison() jqFilter {
+	f := p.sum()
+	switch k := p.peek().kind; k {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		op := jqOps[k]
+		f = jqBinary(f, p.sum(), func(a, b reflect.Value) reflect.Value { return jqCompare(op, a, b) })
+	}
+	return f
+}
+
+func (p *jqParser) sum() jqFilter {
+	f := p.product()
+	for k := p.peek().kind; k == "+" || k == "-"; k = p.peek().kind {
+		p.next()
+		op := jqOps[k]
+		f = jqBinary(f, p.product(), func(a, b reflect.Value) reflect.Value { return jqArith(op, a, b) })
+	}
+	return f
+}
+
+func (p *jqParser) product() jqFilter {
+	f := p.postfix()
+	for k := p.peek().kind; k == "*" || k == "/" || k == "%"; k = p.peek().kind {
+		p.next()
+		op := jqOps[k]
+		f = jqBinary(f, p.postfix(), func(a, b reflect.Value) reflect.Value { return jqArith(op, a, b) })
+	}
+	return f
+}
+
+// jqBinary gives op of each pair of outputs of f and g
+func jqBinary(f, g jqFilter, op func(a, b reflect.Value) reflect.Value) jqFilter {
+	return func(v reflect.Value) []reflect.Value {
+		var out []reflect.Value
+		for _, b := range g(v) {
+			for _, a := range f(v) {
+				out = append(out, op(a, b))
+			}
+		}
+		return out
+	}
+}
+
+// postfix parses a term followed by fields and indices
+func (p *jqParser) postfix() jqFilter {
+	f := p.term()
+	for {
+		switch p.peek().kind {
+		case "field":
+			f = jqCompose(f, jqField(p.next().text))
+		case "[":
+			f = p.index(f)
+		case ".":
+			if p.pos+1 < len(p.toks) && p.toks[p.pos+1].kind == "[" {
+				p.next()
+				f = p.index(f)
+				continue
+			}
+			return f
+		default:
+			return f
+		}
+	}
+}
+
+// index parses [], [i] or [i:j] after f. The index is of the input to f,
+// as in .bbc[.n].
+func (p *jqParser) index(f jqFilter) jqFilter {
+	p.expect("[")
+	if p.peek().kind == "]" {
+		p.next()
+		return jqCompose(f, jqIterate)
+	}
+
+	var from, to jqFilter
+	slice := false
+	if p.peek().kind != ":" {
+		from = p.pipe()
+	}
+	if p.peek().kind == ":" {
+		p.next()
+		slice = true
+		if p.peek().kind != "]" {
+			to = p.pipe()
+		}
+	}
+	p.expect("]")
+
+	outputs := func(g jqFilter, v reflect.Value) []reflect.Value {
+		if g == nil {
+			return []reflect.Value{{}}
+		}
+		return g(v)
+	}
+	return func(v reflect.Value) []reflect.Value {
+		var out []reflect.Value
+		for _, x := range f(v) {
+			for _, i := range outputs(from, v) {
+				if !slice {
+					out = append(out, jqIndex(x, i))
+					continue
+				}
+				for _, j := range outputs(to, v) {
+					out = append(out, jqSlice(x, i, j))
+				}
+			}
+		}
+		return out
+	}
+}
+
+// term parses a path, literal, construction, function or parenthesised
+// filter
+func (p *jqParser) term() jqFilter {
+	t := p.next()
+	switch t.kind {
+	case ".":
+		return jqIdentity
+	case "..":
+		return jqRecurse
+	case "field":
+		return jqField(t.text)
+	case "num":
+		kind := token.INT
+		if strings.ContainsAny(t.text, ".eE") {
+			kind = token.FLOAT
+		}
+		return jqLiteral(constDemote(reflect.ValueOf(constant.MakeFromLiteral(t.text, kind, 0))))
+	case "str":
+		return jqLiteral(reflect.ValueOf(t.text))
+	case "(":
+		f := p.pipe()
+		p.expect(")")
+		return f
+	case "[":
+		if p.peek().kind == "]" {
+			p.next()
+			return jqLiteral(reflect.ValueOf([]interface{}{}))
+		}
+		f := p.pipe()
+		p.expect("]")
+		return func(v reflect.Value) []reflect.Value {
+			return []reflect.Value{jqArray(f(v))}
+		}
+	case "{":
+		return p.object()
+	case "-":
+		f := p.postfix()
+		return func(v reflect.Value) []reflect.Value {
+			var out []reflect.Value
+			for _, x := range f(v) {
+				out = append(out, jqArith(token.SUB, reflect.ValueOf(int64(0)), x))
+			}
+			return out
+		}
+	case "ident":
+		return p.function(t.text)
+	case "":
+		panic("unexpected end of filter")
+	}
+	panic(fmt.Errorf("unexpected %s in filter", t.text))
+}
+
+// function parses the literal or function name
+func (p *jqParser) function(name string) jqFilter {
+	arg := func() jqFilter {
+		p.expect("(")
+		f := p.pipe()
+		p.expect(")")
+		return f
+	}
+	each := func(fn func(x reflect.Value) reflect.Value) jqFilter {
+		return func(v reflect.Value) []reflect.Value {
+			return []reflect.Value{fn(v)}
+		}
+	}
+
+	switch name {
+	case "true", "false":
+		return jqLiteral(reflect.ValueOf(name == "true"))
+	case "null":
+		return jqLiteral(reflect.Value{})
+	case "empty":
+		return func(v reflect.Value) []reflect.Value { return nil }
+	case "not":
+		return each(func(x reflect.Value) reflect.Value { return reflect.ValueOf(!jqTruth(x)) })
+	case "length":
+		return each(jqLength)
+	case "keys":
+		return each(jqKeys)
+	case "select":
+		f := arg()
+		return func(v reflect.Value) []reflect.Value {
+			var out []reflect.Value
+			for _, x := range f(v) {
+				if jqTruth(x) {
+					out = append(out, v)
+				}
+			}
+			return out
+		}
+	case "map":
+		f := jqCompose(jqIterate, arg())
+		return each(func(x reflect.Value) reflect.Value { return jqArray(f(x)) })
+	}
+	panic(fmt.Errorf("unknown function %s in filter", name))
+}
+
+// object parses {key: f, ...}. Keys are names, strings or parenthesised
+// filters, and a key alone takes the field of that name.
+func (p *jqParser) object() jqFilter {
+	type entry struct {
+		key, value jqFilter
+	}
+	var entries []entry
+	for p.peek().kind != "}" {
+		var e entry
+		switch t := p.next(); t.kind {
+		case "ident", "str":
+			e.key = jqLiteral(reflect.ValueOf(t.text))
+			e.value = jqField(t.text)
+		case "(":
+			e.key = p.pipe()
+			p.expect(")")
+		default:
+			panic(fmt.Errorf("unexpected %s in object", t.text))
+		}
+		if p.peek().kind == ":" {
+			p.next()
+			e.value = p.alternative()
+		} else if e.value == nil {
+			panic("expected : in object")
+		}
+		entries = append(entries, e)
+
+		if p.peek().kind != "}" {
+			p.expect(",")
+		}
+	}
+	p.expect("}")
+
+	return func(v reflect.Value) []reflect.Value {
+		// an object for each combination of the outputs of the entries
+		objs := [][2][]reflect.Value{{}}
+		for _, e := range entries {
+			var next [][2][]reflect.Value
+			for _, obj := range objs {
+				for _, k := range e.key(v) {
+					key := jqNorm(k)
+					if !key.IsValid() || key.Kind() != reflect.String {
+						panic("object keys must be strings")
+					}
+					for _, x := range e.value(v) {
+						keys := append(obj[0][:len(obj[0]):len(obj[0])], key)
+						vals := append(obj[1][:len(obj[1]):len(obj[1])], jqNorm(x))
+						next = append(next, [2][]reflect.Value{keys, vals})
+					}
+				}
+			}
+			objs = next
+		}
+
+		out := make([]reflect.Value, len(objs))
+		for i, obj := range objs {
+			out[i] = jqObject(obj[0], obj[1])
+		}
+		return out
+	}
+}
+
+// jqObject makes a struct of vals with json names keys. Later values of
+// the same key replace earlier ones.
+func jqObject(keys, vals []reflect.Value) reflect.Value {
+	var names []string
+	var types []reflect.Type
+	at := map[string]int{}
+	var fields []reflect.Value
+	for i, k := range keys {
+		name := k.String()
+		t := interfaceType
+		if vals[i].IsValid() {
+			t = vals[i].Type()
+		}
+		if j, ok := at[name]; ok {
+			types[j], fields[j] = t, vals[i]
+			continue
+		}
+		at[name] = len(names)
+		names = append(names, name)
+		types = append(types, t)
+		fields = append(fields, vals[i])
+	}
+
+	obj := reflect.New(recordType(names, types)).Elem()
+	for i, v := range fields {
+		if v.IsValid() {
+			obj.Field(i).Set(v)
+		}
+	}
+	return obj
+}
+
+// jqArray makes a slice of vals
+func jqArray(vals []reflect.Value) reflect.Value {
+	if len(vals) == 0 {
+		return reflect.ValueOf([]interface{}{})
+	}
+	for i, v := range vals {
+		vals[i] = jqNorm(v)
+	}
+	return sliceOf(vals)
+}
+
+func jqLiteral(x reflect.Value) jqFilter {
+	return func(v reflect.Value) []reflect.Value {
+		return []reflect.Value{x}
+	}
+}
+
+// jqNorm follows pointers and interfaces, and makes constants Go values
+// and C strings strings, without their blank padding
+func jqNorm(v reflect.Value) reflect.Value {
+	v = deref(v)
+	if !v.IsValid() {
+		return v
+	}
+	if v.CanInterface() {
+		v = constDemote(v)
+	}
+	return cstrOperand(v)
+}
+
+// jqTruth reports if v is neither false nor null
+func jqTruth(v reflect.Value) bool {
+	v = jqNorm(v)
+	if !v.IsValid() {
+		return false
+	}
+	return v.Kind() != reflect.Bool || v.Bool()
+}
+
+// jqType is the JSON type of v, for errors
+func jqType(v reflect.Value) string {
+	if !v.IsValid() {
+		return "null"
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Array, reflect.Slice:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	if isInt(v) || isFloat(v) {
+		return "number"
+	}
+	return v.Type().String()
+}
+
+// jqField gives the field of its input named name, or null if there is
+// none
+func jqField(name string) jqFilter {
+	key := reflect.ValueOf(name)
+	return func(v reflect.Value) []reflect.Value {
+		return []reflect.Value{jqIndex(v, key)}
+	}
+}
+
+// jqIndex is the field or key k of x, or the element at index k
+func jqIndex(x, k reflect.Value) reflect.Value {
+	x, k = jqNorm(x), jqNorm(k)
+	if !x.IsValid() {
+		return x
+	}
+	switch {
+	case k.IsValid() && k.Kind() == reflect.String:
+		return jqMember(x, k.String())
+	case k.IsValid() && (isInt(k) || isFloat(k)) && (x.Kind() == reflect.Array || x.Kind() == reflect.Slice):
+		i := int(number(k))
+		if i < 0 {
+			i += x.Len()
+		}
+		if i < 0 || i >= x.Len() {
+			return reflect.Value{}
+		}
+		return x.Index(i)
+	}
+	panic(fmt.Errorf("cannot index %s with %s", jqType(x), jqType(k)))
+}
+
+// jqMember is the field of struct x with json name name, or the entry of
+// map x with key name
+func jqMember(x reflect.Value, name string) reflect.Value {
+	switch x.Kind() {
+	case reflect.Struct:
+		for _, c := range selChildren(x, "json", "", selStep{glob: "*"}) {
+			if c.path == name {
+				return c.v
+			}
+		}
+		return reflect.Value{}
+	case reflect.Map:
+		if x.Type().Key().Kind() != reflect.String {
+			break
+		}
+		return x.MapIndex(reflect.ValueOf(name).Convert(x.Type().Key()))
+	}
+	panic(fmt.Errorf("cannot index %s with %q", jqType(x), name))
+}
+
+// jqSlice is the elements or characters of x from i to j, null for the
+// start or end
+func jqSlice(x, i, j reflect.Value) reflect.Value {
+	x = jqNorm(x)
+	if !x.IsValid() {
+		return x
+	}
+	if x.Kind() != reflect.String && x.Kind() != reflect.Array && x.Kind() != reflect.Slice {
+		panic(fmt.Errorf("cannot slice %s", jqType(x)))
+	}
+
+	n := x.Len()
+	bound := func(v reflect.Value, def int) int {
+		v = jqNorm(v)
+		if !v.IsValid() {
+			return def
+		}
+		b := int(number(v))
+		if b < 0 {
+			b += n
+		}
+		if b < 0 {
+			return 0
+		}
+		if b > n {
+			return n
+		}
+		return b
+	}
+	from, to := bound(i, 0), bound(j, n)
+	if to < from {
+		to = from
+	}
+
+	if x.Kind() == reflect.String {
+		return reflect.ValueOf(x.String()[from:to])
+	}
+	vals := make([]reflect.Value, to-from)
+	for k := range vals {
+		vals[k] = x.Index(from + k)
+	}
+	return jqArray(vals)
+}
+
+// jqChildren are the elements, field values or map values of x in order,
+// panicking if it has none
+func jqChildren(x reflect.Value) []reflect.Value {
+	x = jqNorm(x)
+	if !x.IsValid() {
+		panic("cannot iterate over null")
+	}
+	var out []reflect.Value
+	switch x.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < x.Len(); i++ {
+			out = append(out, x.Index(i))
+		}
+	case reflect.Struct:
+		for _, c := range selChildren(x, "json", "", selStep{glob: "*"}) {
+			out = append(out, c.v)
+		}
+	case reflect.Map:
+		for _, k := range sortedKeys(x) {
+			out = append(out, x.MapIndex(k))
+		}
+	default:
+		panic(fmt.Errorf("cannot iterate over %s", jqType(x)))
+	}
+	return out
+}
+
+func jqIterate(v reflect.Value) []reflect.Value {
+	return jqChildren(v)
+}
+
+// jqRecurse gives v and everything under it
+func jqRecurse(v reflect.Value) []reflect.Value {
+	out := []reflect.Value{v}
+	switch x := jqNorm(v); {
+	case !x.IsValid(), x.Type() == timeType:
+	case x.Kind() == reflect.Array, x.Kind() == reflect.Slice, x.Kind() == reflect.Struct, x.Kind() == reflect.Map:
+		for _, c := range jqChildren(x) {
+			out = append(out, jqRecurse(c)...)
+		}
+	}
+	return out
+}
+
+// jqLength is the number of characters, elements or fields of x, or the
+// absolute value of a number
+func jqLength(x reflect.Value) reflect.Value {
+	x = jqNorm(x)
+	switch {
+	case !x.IsValid():
+		return reflect.ValueOf(0)
+	case x.Kind() == reflect.String:
+		return reflect.ValueOf(utf8.RuneCountInString(x.String()))
+	case x.Kind() == reflect.Array, x.Kind() == reflect.Slice, x.Kind() == reflect.Map:
+		return reflect.ValueOf(x.Len())
+	case x.Kind() == reflect.Struct:
+		return reflect.ValueOf(len(selChildren(x, "json", "", selStep{glob: "*"})))
+	case isInt(x), isFloat(x):
+		return reflect.ValueOf(math.Abs(number(x)))
+	}
+	panic(fmt.Errorf("%s has no length", jqType(x)))
+}
+
+// jqKeys are the json names of the fields of x or its map keys, sorted, or
+// its indices
+func jqKeys(x reflect.Value) reflect.Value {
+	x = jqNorm(x)
+	var keys []string
+	switch {
+	case !x.IsValid():
+	case x.Kind() == reflect.Array || x.Kind() == reflect.Slice:
+		idx := make([]int, x.Len())
+		for i := range idx {
+			idx[i] = i
+		}
+		return reflect.ValueOf(idx)
+	case x.Kind() == reflect.Struct:
+		for _, c := range selChildren(x, "json", "", selStep{glob: "*"}) {
+			keys = append(keys, c.path)
+		}
+		sort.Strings(keys)
+		return reflect.ValueOf(keys)
+	case x.Kind() == reflect.Map:
+		for _, k := range sortedKeys(x) {
+			keys = append(keys, fmt.Sprint(k))
+		}
+		return reflect.ValueOf(keys)
+	}
+	panic(fmt.Errorf("%s has no keys", jqType(x)))
+}
+
+// jqScalar is v as a constant, if it is a number, string or boolean
+func jqScalar(v reflect.Value) (constant.Value, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+	switch {
+	case isInt(v), isFloat(v), v.Kind() == reflect.String, v.Kind() == reflect.Bool:
+		return constPromote(v), true
+	}
+	return nil, false
+}
+
+// jqCompare compares a and b with op. Values of different types are
+// unequal, and can't be ordered.
+func jqCompare(op token.Token, a, b reflect.Value) reflect.Value {
+	a, b = jqNorm(a), jqNorm(b)
+	x, xok := jqScalar(a)
+	y, yok := jqScalar(b)
+	if xok && yok && compatible(x, y) {
+		return reflect.ValueOf(constant.Compare(x, op, y))
+	}
+
+	var equal bool
+	switch {
+	case !a.IsValid() || !b.IsValid():
+		equal = a.IsValid() == b.IsValid()
+	case xok || yok:
+		equal = false
+	default:
+		equal = reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+	switch op {
+	case token.EQL:
+		return reflect.ValueOf(equal)
+	case token.NEQ:
+		return reflect.ValueOf(!equal)
+	}
+	panic(fmt.Errorf("cannot compare %s and %s", jqType(a), jqType(b)))
+}
+
+// jqArith applies the arithmetic op to a and b. Null added to anything is
+// that thing, and + joins strings.
+func jqArith(op token.Token, a, b reflect.Value) reflect.Value {
+	a, b = jqNorm(a), jqNorm(b)
+	if op == token.ADD && !a.IsValid() {
+		return b
+	}
+	if op == token.ADD && !b.IsValid() {
+		return a
+	}
+
+	x, xok := jqScalar(a)
+	y, yok := jqScalar(b)
+	if !xok || !yok || !compatible(x, y) || x.Kind() == constant.Bool ||
+		x.Kind() == constant.String && op != token.ADD {
+		panic(fmt.Errorf("cannot apply %s to %s and %s", op, jqType(a), jqType(b)))
+	}
+	if op == token.REM {
+		x, y = constant.ToInt(x), constant.ToInt(y)
+		if x.Kind() != constant.Int || y.Kind() != constant.Int {
+			panic("% needs whole numbers")
+		}
+	}
+	if (op == token.QUO || op == token.REM) && constant.Sign(y) == 0 {
+		panic("division by zero")
+	}
+	return constDemote(reflect.ValueOf(constant.BinaryOp(x, op, y)))
+}
+
+// jq(x, filter) is the result of the jq filter on x, or a list of them if
+// it gives none or several
+func jq(x interface{}, filter string) interface{} {
+	outs := parseJQ(filter)(reflect.ValueOf(x))
+	if len(outs) == 1 {
+		if v := jqNorm(outs[0]); v.IsValid() {
+			return v.Interface()
+		}
+		return nil
+	}
+	return jqArray(outs).Interface()
+}
+
+// compileJQ parses the filter src
+func compileJQ(src string) (f jqFilter, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	return parseJQ(src), nil
+}
+
+// runJQ applies the filter src to v, for -jq
+func runJQ(v reflect.Value, src string) (outs []reflect.Value, err error) {
+	f, err := compileJQ(src)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	for _, out := range f(v) {
+		out = jqNorm(out)
+		if !out.IsValid() {
+			out = reflect.Zero(interfaceType)
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
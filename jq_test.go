@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJQ(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		// paths
+		{src: "jq(fs.equip, `.`)", want: `{"rack":4}`},
+		{src: "jq(fs, `.lsorna`)", want: `"3C84"`},
+		{src: "jq(fs, `.bbc[1].freq`)", want: "200"},
+		{src: "jq(fs, `.bbc[-1].freq`)", want: "400"},
+		{src: "jq(fs, `[.bbc[9], .nothing]`)", want: "[null,null]"},
+		{src: "jq(fs, `.[\"equip\"].rack`)", want: "4"},
+		{src: "jq(fs, `.equip | .rack`)", want: "4"},
+		{src: "jq(fs, `.bbc[1:3] | map(.freq)`)", want: "[200,300]"},
+		{src: "jq(fs, `.bbc[2:] | length`)", want: "2"},
+		{src: "jq(fs, `.bbc[0].bw[]`)", want: "[4,8]"},
+		{src: "jq(fs, `.bbc[].name`)", want: `["a","b","3C84","d"]`},
+		{src: "jq(fs.bbc[0], `.freq?`)", err: "unexpected '?' in filter"},
+		{src: "jq(fs.bbc[0], `[..] | length`)", want: "7"},
+		{src: "jq(fs, `.bbc[0].freq, .equip.rack`)", want: "[100,4]"},
+		{src: "jq(fs, `.lsorna.x`)", err: `cannot index string with "x"`},
+		{src: "jq(fs, `.bbc.x`)", err: `cannot index array with "x"`},
+
+		// select, map and the other functions
+		{src: "jq(fs, `[.bbc[] | select(.freq > 150 and .freq < 350) | .name]`)", want: `["b","3C84"]`},
+		{src: "jq(fs, `.bbc[] | select(.name == \"3C84\") | .freq`)", want: "300"},
+		{src: "jq(fs, `.bbc[] | select(.freq > 1000)`)", want: "[]"},
+		{src: "jq(fs, `[.bbc[] | select(.freq == 100 or .freq == 400) | .freq]`)", want: "[100,400]"},
+		{src: "jq(fs, `[.bbc[] | select(.freq > 200 | not) | .freq]`)", want: "[100,200]"},
+		{src: "jq(fs, `.bbc | map(.freq * 2)`)", want: "[200,400,600,800]"},
+		{src: "jq(fs, `.bbc[0] | keys`)", want: `["bw","freq","name","tsys"]`},
+		{src: "jq(fs, `.bbc[0].bw | keys`)", want: "[0,1]"},
+		{src: "jq(fs, `.lsorna | length`)", want: "4"},
+		{src: "jq(fs, `.bbc | length`)", want: "4"},
+		{src: "jq(fs, `.equip | length`)", want: "1"},
+		{src: "jq(fs, `-5 | length`)", want: "5"},
+		{src: "jq(fs, `null | length`)", want: "0"},
+		{src: "jq(fs, `true | length`)", err: "boolean has no length"},
+		{src: "jq(fs, `1 | keys`)", err: "number has no keys"},
+		{src: "jq(fs, `.bbc[] | empty`)", want: "[]"},
+		{src: "jq(fs, `nope`)", err: "unknown function nope"},
+
+		// construction
+		{src: "jq(fs, `{source: .lsorna, rack: .equip.rack}`)", want: `{"source":"3C84","rack":4}`},
+		{src: "jq(fs.bbc[1], `{name, freq}`)", want: `{"name":"b","freq":200}`},
+		{src: "jq(fs.bbc[1], `{\"a b\": .freq, (.name): 1}`)", want: `{"a b":200,"b":1}`},
+		{src: "jq(fs.bbc[1], `{a: 1, a: 2}`)", want: `{"a":2}`},
+		{src: "jq(fs, `[.bbc[] | {name, f: .freq}] | .[1]`)", want: `{"name":"b","f":200}`},
+		{src: "jq(fs, `[.bbc[0].freq, .lsorna, null, true]`)", want: `[100,"3C84",null,true]`},
+		{src: "jq(fs, `[]`)", want: "[]"},
+		{src: "jq(fs, `{a: .bbc[].freq} | .a`)", want: "[100,200,300,400]"},
+
+		// comparisons, arithmetic and alternatives
+		{src: "jq(fs, `.lsorna == \"3C84\"`)", want: "true"},
+		{src: "jq(fs, `.bbc[0].freq == \"100\"`)", want: "false"},
+		{src: "jq(fs, `.bbc[0].bw == .bbc[1].bw`)", want: "true"},
+		{src: "jq(fs, `.bbc[0] != .bbc[1]`)", want: "true"},
+		{src: "jq(fs, `null == null`)", want: "true"},
+		{src: "jq(fs, `.bbc[0].bw < .bbc[1].bw`)", err: "cannot compare array and array"},
+		{src: "jq(fs, `.bbc[1].freq - .bbc[0].freq * 2 + 1`)", want: "1"},
+		{src: "jq(fs, `(.bbc[1].freq - .bbc[0].freq) * 2`)", want: "200"},
+		{src: "jq(fs, `.bbc[2].freq / 200`)", want: "1.5"},
+		{src: "jq(fs, `.bbc[2].freq % 200`)", want: "100"},
+		{src: "jq(fs, `1 / 0`)", err: "division by zero"},
+		{src: "jq(fs, `.lsorna + \"-\" + .bbc[0].name`)", want: `"3C84-a"`},
+		{src: "jq(fs, `.lsorna - 1`)", err: "cannot apply - to string and number"},
+		{src: "jq(fs, `null + 1`)", want: "1"},
+		{src: "jq(fs, `.nothing // .lsorna`)", want: `"3C84"`},
+		{src: "jq(fs, `false // 2`)", want: "2"},
+		{src: "jq(fs, `.equip.rack // 2`)", want: "4"},
+		{src: "jq(fs, `[.bbc[].nothing] // 1 | length`)", want: "4"},
+
+		// syntax
+		{src: "jq(fs, `.bbc[`)", err: "unexpected end of filter"},
+		{src: "jq(fs, `.lsorna == \"3C`)", err: "unterminated string in filter"},
+		{src: "jq(fs, `(.lsorna`)", err: "expected )"},
+	})
+}
+
+func TestRunJQ(t *testing.T) {
+	v := reflect.ValueOf(newTestShm())
+	tests := []struct {
+		filter string
+		want   []interface{}
+		err    string
+	}{
+		{".lsorna", []interface{}{"3C84"}, ""},
+		{".bbc[].freq", []interface{}{int32(100), int32(200), int32(300), int32(400)}, ""},
+		{".nothing", []interface{}{nil}, ""},
+		{".bbc[] | select(.freq > 1000)", nil, ""},
+		{"1 + 2", []interface{}{int64(3)}, ""},
+		{".bbc[", nil, "unexpected end of filter"},
+		{".lsorna * 2", nil, "cannot apply * to string and number"},
+	}
+	for _, tt := range tests {
+		outs, err := runJQ(v, tt.filter)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("runJQ(%q): got error %v, want %q", tt.filter, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("runJQ(%q): %v", tt.filter, err)
+			continue
+		}
+		var got []interface{}
+		for _, out := range outs {
+			got = append(got, out.Interface())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("runJQ(%q) = %#v, want %#v", tt.filter, got, tt.want)
+		}
+	}
+
+	if _, err := compileJQ("{a"); err == nil {
+		t.Error("compileJQ({a): no error")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strings"
+)
+
+// defaultKeyField is the field identifying the elements of arrays of
+// structs with no key in keyFields
+const defaultKeyField = "name"
+
+// keyFields are the fields identifying the elements of arrays of structs,
+// keyed by json path without indices as for fieldNote, or by the name of the
+// element type. Stations add theirs to keys.json, eg
+//
+//	{"flux": "source", "fs.Bbc": "label"}
+var keyFields = map[string]string{}
+
+var keysLoaded bool
+
+// loadKeys adds the key fields in fsq/keys.json in the user's config
+// directory, or $FSQ_KEYS, to keyFields
+func loadKeys() error {
+	if keysLoaded {
+		return nil
+	}
+	keysLoaded = true
+	return readConfig("FSQ_KEYS", "keys.json", &keyFields)
+}
+
+// keyField is the field identifying the elements of the array v at path
+func keyField(v reflect.Value, path []string) string {
+	if err := loadKeys(); err != nil {
+		panic(err)
+	}
+	if name, ok := keyFields[strings.Join(path, ".")]; ok {
+		return name
+	}
+	t := v.Type().Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if name, ok := keyFields[t.String()]; ok {
+		return name
+	}
+	return defaultKeyField
+}
+
+// keyed reports if v is an array or slice of structs, which may be indexed
+// by key
+func keyed(v reflect.Value) bool {
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+		return false
+	}
+	t := v.Type().Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// byKey returns the one element of the array of structs v whose field name
+// is value. C strings are compared as strings, ignoring trailing spaces.
+func (terp *interpreter) byKey(v reflect.Value, name, value string) reflect.Value {
+	var found []int
+	for i := 0; i < v.Len(); i++ {
+		e := deref(v.Index(i))
+		if !e.IsValid() {
+			continue
+		}
+		f := terp.field(e, name)
+		if !f.IsValid() {
+			panic(fmt.Errorf("%s has no field %s", e.Type(), name))
+		}
+		if strings.TrimRight(groupKey(f), " ") == value {
+			found = append(found, i)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		panic(fmt.Errorf("no element with %s %q", name, value))
+	case 1:
+	default:
+		panic(fmt.Errorf("%d elements with %s %q, at %v", len(found), name, value, found))
+	}
+	e := v.Index(found[0])
+	if !e.CanAddr() {
+		return e
+	}
+	return e.Addr()
+}
+
+// byname(xs, field, value) is the one element of the array of structs xs
+// whose field is value
+func byname(terp *interpreter, args []ast.Expr) reflect.Value {
+	if len(args) != 3 {
+		panic("byname takes three arguments")
+	}
+	v := deref(terp.eval(args[0]))
+	if !v.IsValid() || !keyed(v) {
+		panic(fmt.Errorf("%s is not an array of structs", expfmt(args[0])))
+	}
+	return terp.byKey(v, text(terp.eval(args[1])), text(terp.eval(args[2])))
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A logRecord is a line of an FS log
+type logRecord struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`   // command, response, message, error, comment or other
+	Source string    `json:"source"` // program that logged a message
+	Name   string    `json:"name"`   // command or response name
+	Params []string  `json:"params"`
+	Line   string    `json:"line"` // everything after the time
+}
+
+type logRecords []logRecord
+
+var logBuiltins = []builtin{
+	{"named", named, "named(recs, glob...)", "records with names matching any of the globs"},
+	{"between", between, "between(recs, from, to)", "records logged from up to to; times are times, or FS, RFC 3339 or hh:mm[:ss] strings"},
+	{"grep", grep, "grep(recs, regexp)", "records with lines matching regexp"},
+	{"param", param, "param(recs, i)", "parameter i of each record"},
+	{"values", values, "values(recs, i)", "numeric parameter i of each record that has one"},
+	{"above", above, "above(recs, i, x)", "records with numeric parameter i greater than x"},
+	{"below", below, "below(recs, i, x)", "records with numeric parameter i less than x"},
+}
+
+// parseFSTime parses times as in FS logs, yyyy.ddd.hh:mm:ss.ss in UTC.
+// Trailing fields may be left off.
+func parseFSTime(s string) (time.Time, error) {
+	var year, doy, hour, min int
+	var sec float64
+	n, _ := fmt.Sscanf(s, "%4d.%3d.%2d:%2d:%f", &year, &doy, &hour, &min, &sec)
+	if n < 2 {
+		return time.Time{}, fmt.Errorf("bad FS time %q", s)
+	}
+	return fsDate(year, doy, hour, min, sec), nil
+}
+
+// fsDate is the time sec seconds after hour:min on day doy of year, to the
+// nearest nanosecond, so centiseconds like 1.23 aren't a hair short
+func fsDate(year, doy, hour, min int, sec float64) time.Time {
+	t := time.Date(year, 1, 1, hour, min, 0, 0, time.UTC)
+	return t.AddDate(0, 0, doy-1).Add(time.Duration(math.Round(sec * 1e9)))
+}
+
+// parseLogTime parses the time at the start of a log line, which is always
+// yyyy.ddd.hh:mm:ss.ss
+func parseLogTime(s string) (time.Time, bool) {
+	if len(s) < 20 || s[4] != '.' || s[8] != '.' || s[11] != ':' || s[14] != ':' || s[17] != '.' {
+		return time.Time{}, false
+	}
+	var f [6]int
+	for i, span := range [6][2]int{{0, 4}, {5, 8}, {9, 11}, {12, 14}, {15, 17}, {18, 20}} {
+		n, err := strconv.Atoi(s[span[0]:span[1]])
+		if err != nil {
+			return time.Time{}, false
+		}
+		f[i] = n
+	}
+	return fsDate(f[0], f[1], f[2], f[3], float64(f[4])+float64(f[5])/100), true
+}
+
+// parseLogLine splits an FS log line into a record. The character after the
+// time gives the type of line:
+//
+//	:command=params
+//	/response/params
+//	#program#message
+//	?error
+//	"comment
+func parseLogLine(line string) (logRecord, bool) {
+	t, ok := parseLogTime(line)
+	if !ok || len(line) < 21 {
+		return logRecord{}, false
+	}
+
+	rec := logRecord{Time: t, Line: line[20:]}
+	text := line[21:]
+	switch line[20] {
+	case ':':
+		rec.Type = "command"
+		rec.Name = text
+		if i := strings.IndexByte(text, '='); i != -1 {
+			rec.Name = text[:i]
+			rec.Params = splitParams(text[i+1:])
+		}
+	case '/':
+		rec.Type = "response"
+		rec.Name = text
+		if i := strings.IndexByte(text, '/'); i != -1 {
+			rec.Name = text[:i]
+			rec.Params = splitParams(text[i+1:])
+		}
+	case '#':
+		rec.Type = "message"
+		if i := strings.IndexByte(text, '#'); i != -1 {
+			rec.Source = text[:i]
+			rec.Params = splitParams(text[i+1:])
+		}
+	case '?':
+		rec.Type = "error"
+		fields := strings.Fields(text)
+		if len(fields) > 0 {
+			rec.Name = fields[0]
+			rec.Params = fields[1:]
+		}
+	case '"':
+		rec.Type = "comment"
+		rec.Params = []string{text}
+	default:
+		rec.Type = "other"
+	}
+	return rec, true
+}
+
+// splitParams splits the parameters of a log line at commas, except in the
+// quoted keys and values written by fsq. Only a quote starting a key or
+// value opens a string, so stray quotes in other lines don't.
+func splitParams(s string) []string {
+	var params []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case quoted && c == '"':
+			quoted = false
+		case c == '"' && (i == start || s[i-1] == '='):
+			quoted = true
+		case c == ',' && !quoted:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(params, s[start:])
+}
+
+// readLog reads the records from an FS log. Lines without a time are
+// skipped.
+func readLog(r io.Reader) (logRecords, error) {
+	var recs logRecords
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if rec, ok := parseLogLine(scanner.Text()); ok {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, scanner.Err()
+}
+
+// logTime parses a time argument to the log builtins: an FS time,
+// RFC 3339 or hh:mm[:ss] on the day of ref
+func logTime(s string, ref time.Time) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			y, m, d := ref.UTC().Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+		}
+	}
+	t, err := parseFSTime(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// named returns the records with a name matching any of the glob patterns
+func named(recs logRecords, patterns ...string) logRecords {
+	out := logRecords{}
+	for _, rec := range recs {
+		for _, p := range patterns {
+			if ok, err := path.Match(p, rec.Name); err != nil {
+				panic(err)
+			} else if ok {
+				out = append(out, rec)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// between returns the records logged in [from, to). Times of day are on the
+// day of the first record.
+func between(recs logRecords, from, to interface{}) logRecords {
+	out := logRecords{}
+	if len(recs) == 0 {
+		return out
+	}
+	start := toTime(reflect.ValueOf(from), recs[0].Time)
+	end := toTime(reflect.ValueOf(to), recs[0].Time)
+	for _, rec := range recs {
+		if !rec.Time.Before(start) && rec.Time.Before(end) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// grep returns the records with lines matching the regular expression re
+func grep(recs logRecords, re string) logRecords {
+	r := regexp.MustCompile(re)
+	out := logRecords{}
+	for _, rec := range recs {
+		if r.MatchString(rec.Line) {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// param returns parameter i of each record, or "" if it has none
+func param(recs logRecords, i int) []string {
+	out := make([]string, len(recs))
+	for j, rec := range recs {
+		if i >= 0 && i < len(rec.Params) {
+			out[j] = strings.TrimSpace(rec.Params[i])
+		}
+	}
+	return out
+}
+
+func paramFloat(rec logRecord, i int) (float64, bool) {
+	if i < 0 || i >= len(rec.Params) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(rec.Params[i]), 64)
+	return f, err == nil
+}
+
+// values returns parameter i of each record as a number, skipping records
+// where it is missing or not a number
+func values(recs logRecords, i int) []float64 {
+	out := []float64{}
+	for _, rec := range recs {
+		if f, ok := paramFloat(rec, i); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// above returns the records with numeric parameter i greater than x
+func above(recs logRecords, i int, x float64) logRecords {
+	out := logRecords{}
+	for _, rec := range recs {
+		if f, ok := paramFloat(rec, i); ok && f > x {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// below returns the records with numeric parameter i less than x
+func below(recs logRecords, i int, x float64) logRecords {
+	out := logRecords{}
+	for _, rec := range recs {
+		if f, ok := paramFloat(rec, i); ok && f < x {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func logMain(args []string) {
+	flags := flag.NewFlagSet("log", flag.ExitOnError)
+	flags.StringVar(&outputFormat, "o", outputFormat, "output `format`: json, influx, fslog, table or csv")
+	exps := flags.String("e", "", "evaluate `statements` and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsq log [flags] file...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var recs logRecords
+	for _, name := range flags.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "log:", err)
+			os.Exit(1)
+		}
+		r, err := readLog(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log: %s: %s\n", name, err)
+			os.Exit(1)
+		}
+		recs = append(recs, r...)
+	}
+
+	terp := newInterp()
+	terp.Global("log", recs)
+	register(terp, logBuiltins)
+	loadInit(terp)
+
+	var exp []string
+	if *exps != "" {
+		exp = append(exp, *exps)
+	}
+	run(terp, exp)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"go/constant"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var mathBuiltins = []builtin{
+	{"len", length, "len(x)", "length of the array, slice, map or string x"},
+	{"cap", capacity, "cap(x)", "capacity of the array or slice x"},
+	{"abs", abs, "abs(x)", "absolute value of x"},
+	{"min", minimum, "min(x...)", "smallest of the values in x"},
+	{"max", maximum, "max(x...)", "largest of the values in x"},
+	{"sum", sum, "sum(x...)", "sum of the values in x"},
+	{"mean", mean, "mean(x...)", "mean of the values in x"},
+	{"std", std, "std(x...)", "sample standard deviation of the values in x"},
+	{"median", median, "median(x...)", "median of the values in x"},
+	{"round", round, "round(x[, n])", "x rounded to n decimal places, 0 by default, half away from zero"},
+	{"floor", floor, "floor(x)", "greatest integer less than or equal to x"},
+	{"ceil", ceil, "ceil(x)", "least integer greater than or equal to x"},
+	{"sqrt", sqrt, "sqrt(x)", "square root of x"},
+	{"pow", pow, "pow(x, y)", "x to the power y"},
+	{"log10", log10, "log10(x)", "base 10 logarithm of x"},
+	{"dB", dB, "dB(x)", "power ratio x in decibels"},
+	{"fromdB", fromdB, "fromdB(x)", "power ratio of x decibels"},
+	{"sin", sin, "sin(x)", "sine of x radians"},
+	{"cos", cos, "cos(x)", "cosine of x radians"},
+	{"tan", tan, "tan(x)", "tangent of x radians"},
+	{"asin", asin, "asin(x)", "arcsine of x, in radians"},
+	{"acos", acos, "acos(x)", "arccosine of x, in radians"},
+	{"atan", atan, "atan(x)", "arctangent of x, in radians"},
+	{"isnan", isnan, "isnan(x)", "whether x is NaN"},
+	{"isinf", isinf, "isinf(x)", "whether x is infinite"},
+	{"atan2", atan2, "atan2(y, x)", "arctangent of y/x in radians, using the signs of both for the quadrant"},
+}
+
+// Numbers given to the math builtins may be scalars, or arrays and slices
+// of them, of any numeric type or constants. Functions of one number apply
+// to each element of an array, and functions of two to each pair of
+// elements, or each element and a scalar. The aggregates take all of the
+// numbers in their arguments.
+
+// number converts the numeric value v to a float64
+func number(v reflect.Value) float64 {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			panic("nil is not a number")
+		}
+		v = v.Elem()
+	}
+	if c, ok := v.Interface().(constant.Value); ok {
+		if c.Kind() != constant.Int && c.Kind() != constant.Float {
+			panic(fmt.Errorf("%s is not a number", c))
+		}
+		f, _ := constant.Float64Val(c)
+		return f
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	panic(fmt.Errorf("%s is not a number", v.Type()))
+}
+
+// elements returns the elements of v if it's an array or slice, other than
+// a C string
+func elements(v reflect.Value) ([]reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice || isCString(v.Type()) {
+		return nil, false
+	}
+	elems := make([]reflect.Value, v.Len())
+	for i := range elems {
+		elems[i] = v.Index(i)
+	}
+	return elems, true
+}
+
+// elementwise applies f to x, or each element of x
+func elementwise(x reflect.Value, f func(float64) float64) interface{} {
+	return numberwise(x, func(n float64) interface{} { return f(n) })
+}
+
+// numberwise is elementwise for functions of numbers to anything
+func numberwise(x reflect.Value, f func(float64) interface{}) interface{} {
+	elems, ok := elements(x)
+	if !ok {
+		return f(number(x))
+	}
+	out := make([]interface{}, len(elems))
+	for i, e := range elems {
+		out[i] = numberwise(e, f)
+	}
+	return out
+}
+
+// pairwise applies f to x and y, or each pair of their elements
+func pairwise(x, y reflect.Value, f func(float64, float64) float64) interface{} {
+	xs, xok := elements(x)
+	ys, yok := elements(y)
+	switch {
+	case !xok && !yok:
+		return f(number(x), number(y))
+	case xok && yok && len(xs) != len(ys):
+		panic(fmt.Errorf("lengths %d and %d differ", len(xs), len(ys)))
+	}
+
+	n := len(xs)
+	if !xok {
+		n = len(ys)
+	}
+	out := make([]interface{}, n)
+	for i := range out {
+		a, b := x, y
+		if xok {
+			a = xs[i]
+		}
+		if yok {
+			b = ys[i]
+		}
+		out[i] = pairwise(a, b, f)
+	}
+	return out
+}
+
+// numbers returns all of the numbers in xs, in order
+func numbers(xs []interface{}) []float64 {
+	var out []float64
+	var add func(v reflect.Value)
+	add = func(v reflect.Value) {
+		if elems, ok := elements(v); ok {
+			for _, e := range elems {
+				add(e)
+			}
+			return
+		}
+		out = append(out, number(v))
+	}
+	for _, x := range xs {
+		add(reflect.ValueOf(x))
+	}
+	return out
+}
+
+// mathFunc makes a builtin applying f to a number or array of them
+func mathFunc(f func(float64) float64) func(interface{}) interface{} {
+	return func(x interface{}) interface{} {
+		return elementwise(reflect.ValueOf(x), f)
+	}
+}
+
+// mathFunc2 makes a builtin applying f to two numbers or arrays of them
+func mathFunc2(f func(float64, float64) float64) func(x, y interface{}) interface{} {
+	return func(x, y interface{}) interface{} {
+		return pairwise(reflect.ValueOf(x), reflect.ValueOf(y), f)
+	}
+}
+
+var (
+	abs   = mathFunc(math.Abs)
+	floor = mathFunc(math.Floor)
+	ceil  = mathFunc(math.Ceil)
+	sqrt  = mathFunc(math.Sqrt)
+	log10 = mathFunc(math.Log10)
+	sin   = mathFunc(math.Sin)
+	cos   = mathFunc(math.Cos)
+	tan   = mathFunc(math.Tan)
+	asin  = mathFunc(math.Asin)
+	acos  = mathFunc(math.Acos)
+	atan  = mathFunc(math.Atan)
+	pow   = mathFunc2(math.Pow)
+	atan2 = mathFunc2(math.Atan2)
+
+	isnan = func(x interface{}) interface{} {
+		return numberwise(reflect.ValueOf(x), func(f float64) interface{} { return math.IsNaN(f) })
+	}
+	isinf = func(x interface{}) interface{} {
+		return numberwise(reflect.ValueOf(x), func(f float64) interface{} { return math.IsInf(f, 0) })
+	}
+
+	dB     = mathFunc(func(x float64) float64 { return 10 * math.Log10(x) })
+	fromdB = mathFunc(func(x float64) float64 { return math.Pow(10, x/10) })
+)
+
+// round(x[, n]) rounds x to n decimal places
+func round(x interface{}, n ...int) interface{} {
+	if len(n) > 1 {
+		panic("round takes at most two arguments")
+	}
+	scale := 1.0
+	if len(n) == 1 {
+		scale = math.Pow(10, float64(n[0]))
+	}
+	return elementwise(reflect.ValueOf(x), func(f float64) float64 {
+		return math.Round(f*scale) / scale
+	})
+}
+
+func length(x interface{}) int {
+	v := reflect.ValueOf(x)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return v.Len()
+	}
+	panic(fmt.Errorf("invalid argument to len: %s", v.Type()))
+}
+
+func capacity(x interface{}) int {
+	v := reflect.ValueOf(x)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		return v.Cap()
+	}
+	panic(fmt.Errorf("invalid argument to cap: %s", v.Type()))
+}
+
+// some returns the numbers in xs, panicking if there are none
+func some(name string, xs []interface{}) []float64 {
+	nums := numbers(xs)
+	if len(nums) == 0 {
+		panic(name + " of no values")
+	}
+	return nums
+}
+
+func minimum(xs ...interface{}) float64 {
+	nums := some("min", xs)
+	m := nums[0]
+	for _, f := range nums[1:] {
+		m = math.Min(m, f)
+	}
+	return m
+}
+
+func maximum(xs ...interface{}) float64 {
+	nums := some("max", xs)
+	m := nums[0]
+	for _, f := range nums[1:] {
+		m = math.Max(m, f)
+	}
+	return m
+}
+
+func sum(xs ...interface{}) float64 {
+	s := 0.0
+	for _, f := range numbers(xs) {
+		s += f
+	}
+	return s
+}
+
+func mean(xs ...interface{}) float64 {
+	nums := some("mean", xs)
+	return sum(nums) / float64(len(nums))
+}
+
+func std(xs ...interface{}) float64 {
+	nums := some("std", xs)
+	if len(nums) < 2 {
+		return 0
+	}
+	m := mean(nums)
+	ss := 0.0
+	for _, f := range nums {
+		ss += (f - m) * (f - m)
+	}
+	return math.Sqrt(ss / float64(len(nums)-1))
+}
+
+func median(xs ...interface{}) float64 {
+	nums := some("median", xs)
+	sort.Float64s(nums)
+	n := len(nums)
+	if n%2 == 1 {
+		return nums[n/2]
+	}
+	return (nums[n/2-1] + nums[n/2]) / 2
+}
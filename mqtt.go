@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPubrec     = 5
+	mqttPubrel     = 6
+	mqttPubcomp    = 7
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+var connackErrors = []string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// An mqttClient is a minimal MQTT 3.1.1 client that can only publish.
+// Acknowledgements are waited for synchronously, so it must be used from a
+// single goroutine.
+type mqttClient struct {
+	Broker    string // tcp://host:port or ssl://host:port
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	Timeout   time.Duration
+
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+	lastSent time.Time
+}
+
+func (c *mqttClient) connected() bool {
+	return c.conn != nil
+}
+
+func (c *mqttClient) Connect() error {
+	if c.Password != "" && c.Username == "" {
+		return errors.New("a password needs a user name")
+	}
+
+	u, err := url.Parse(c.Broker)
+	if err != nil {
+		return err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if u.Scheme == "ssl" || u.Scheme == "tls" || u.Scheme == "mqtts" {
+			port = "8883"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", host)
+	case "ssl", "tls", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	var flags byte = 0x02 // clean session
+	var payload bytes.Buffer
+	writeString(&payload, c.ClientID)
+	if c.Username != "" {
+		flags |= 0x80
+		writeString(&payload, c.Username)
+		// 3.1.1 only allows a password with a user name
+		if c.Password != "" {
+			flags |= 0x40
+			writeString(&payload, c.Password)
+		}
+	}
+
+	var body bytes.Buffer
+	writeString(&body, "MQTT")
+	body.WriteByte(4) // protocol level 3.1.1
+	body.WriteByte(flags)
+	binary.Write(&body, binary.BigEndian, uint16(c.KeepAlive/time.Second))
+	body.Write(payload.Bytes())
+
+	if err := c.send(mqttConnect<<4, body.Bytes()); err != nil {
+		c.Close()
+		return err
+	}
+
+	typ, resp, err := c.receive()
+	if err != nil {
+		c.Close()
+		return err
+	}
+	if typ != mqttConnack || len(resp) != 2 {
+		c.Close()
+		return fmt.Errorf("expected CONNACK, got packet type %d", typ)
+	}
+	if code := int(resp[1]); code != 0 {
+		c.Close()
+		if code < len(connackErrors) {
+			return fmt.Errorf("connection refused: %s", connackErrors[code])
+		}
+		return fmt.Errorf("connection refused: code %d", code)
+	}
+	return nil
+}
+
+// Publish sends payload to topic, waiting for the broker's acknowledgement
+// if qos > 0.
+func (c *mqttClient) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	if qos > 2 {
+		return fmt.Errorf("invalid QoS %d", qos)
+	}
+
+	header := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+
+	var body bytes.Buffer
+	writeString(&body, topic)
+	var id uint16
+	if qos > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID++
+		}
+		id = c.packetID
+		binary.Write(&body, binary.BigEndian, id)
+	}
+	body.Write(payload)
+
+	if err := c.send(header, body.Bytes()); err != nil {
+		return err
+	}
+
+	switch qos {
+	case 1:
+		return c.await(mqttPuback, id)
+	case 2:
+		if err := c.await(mqttPubrec, id); err != nil {
+			return err
+		}
+		if err := c.send(mqttPubrel<<4|0x02, packetIDBytes(id)); err != nil {
+			return err
+		}
+		return c.await(mqttPubcomp, id)
+	}
+	return nil
+}
+
+// Ping sends a PINGREQ if nothing has been sent for half the keep alive
+// period, so the broker doesn't drop the connection between publishes.
+func (c *mqttClient) Ping() error {
+	if c.KeepAlive == 0 || time.Since(c.lastSent) < c.KeepAlive/2 {
+		return nil
+	}
+	if err := c.send(mqttPingreq<<4, nil); err != nil {
+		return err
+	}
+	return c.await(mqttPingresp, 0)
+}
+
+func (c *mqttClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	c.send(mqttDisconnect<<4, nil)
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// await reads packets until one of type typ with packet identifier id
+func (c *mqttClient) await(typ byte, id uint16) error {
+	for {
+		t, body, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if t != typ {
+			continue
+		}
+		if typ == mqttPingresp {
+			return nil
+		}
+		if len(body) >= 2 && binary.BigEndian.Uint16(body) == id {
+			return nil
+		}
+	}
+}
+
+func (c *mqttClient) send(header byte, body []byte) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(header)
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf.WriteByte(b)
+		if n == 0 {
+			break
+		}
+	}
+	buf.Write(body)
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	c.lastSent = time.Now()
+	return nil
+}
+
+func (c *mqttClient) receive() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.Timeout))
+
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		mult *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func packetIDBytes(id uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, id)
+	return b
+}
+
+// A topic is an expression published to an MQTT topic
+type topic struct {
+	Topic    string
+	Expr     string
+	QoS      byte
+	Retain   bool
+	Interval time.Duration // time between evaluations
+	Change   bool          // only publish when the value changes
+
+	next time.Time
+	last []byte
+}
+
+// readTopics parses a topics file. This is a small subset of YAML: a list
+// of flat mappings, optionally under a "topics:" key, eg
+//
+//	topics:
+//	  - topic: station/fs/source
+//	    expr: str(fs.lsorna)
+//	    qos: 1
+//	    retain: true
+//	    interval: 5s
+//	    change: true
+func readTopics(r io.Reader, interval time.Duration) ([]*topic, error) {
+	var topics []*topic
+	var t *topic
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" || line[0] == '#' || line == "topics:" || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "-") {
+			t = &topic{Interval: interval}
+			topics = append(topics, t)
+			line = strings.TrimSpace(line[1:])
+			if line == "" {
+				continue
+			}
+		}
+		if t == nil {
+			return nil, fmt.Errorf("line %d: expected list item", lineno)
+		}
+
+		idx := strings.Index(line, ":")
+		if idx == -1 {
+			return nil, fmt.Errorf("line %d: expected key: value", lineno)
+		}
+		key := strings.TrimSpace(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		var err error
+		switch key {
+		case "topic":
+			t.Topic = value
+		case "expr", "expression":
+			t.Expr = value
+		case "qos":
+			var q uint64
+			q, err = strconv.ParseUint(value, 10, 8)
+			if err == nil && q > 2 {
+				err = fmt.Errorf("QoS must be 0, 1 or 2")
+			}
+			t.QoS = byte(q)
+		case "retain":
+			t.Retain, err = strconv.ParseBool(value)
+		case "interval":
+			t.Interval, err = time.ParseDuration(value)
+		case "change":
+			t.Change, err = strconv.ParseBool(value)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, t := range topics {
+		if t.Topic == "" || t.Expr == "" {
+			return nil, fmt.Errorf("topic %d: both topic and expr are required", i+1)
+		}
+		if t.Interval <= 0 {
+			return nil, fmt.Errorf("topic %q: interval must be positive", t.Topic)
+		}
+	}
+	return topics, nil
+}
+
+// stripComment removes a # comment from line. As in YAML, a # starts a
+// comment at the start of the line or after a space, but not in a quoted
+// value.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		start := i == 0 || strings.IndexByte(" \t:-", line[i-1]) != -1
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && start:
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func mqttMain(args []string) {
+	flags := flag.NewFlagSet("mqtt", flag.ExitOnError)
+	broker := flags.String("broker", "tcp://localhost:1883", "broker `url`, tcp:// or ssl://")
+	config := flags.String("config", "", "topics `file`")
+	clientID := flags.String("id", "", "client `id` (default fsq-<hostname>)")
+	username := flags.String("user", "", "user `name`")
+	password := flags.String("password", os.Getenv("MQTT_PASSWORD"), "`password`, default $MQTT_PASSWORD")
+	interval := flags.Duration("interval", 10*time.Second, "default publish `interval`")
+	keepalive := flags.Duration("keepalive", 60*time.Second, "keep alive `period`")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsq mqtt -broker url -config topics.yaml [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *config == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *password != "" && *username == "" {
+		fmt.Fprintln(os.Stderr, "mqtt: a password (-password or $MQTT_PASSWORD) needs -user")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mqtt:", err)
+		os.Exit(1)
+	}
+	topics, err := readTopics(f, *interval)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mqtt: %s: %s\n", *config, err)
+		os.Exit(1)
+	}
+	if len(topics) == 0 {
+		fmt.Fprintf(os.Stderr, "mqtt: %s: no topics\n", *config)
+		os.Exit(1)
+	}
+
+	if *clientID == "" {
+		host, _ := os.Hostname()
+		*clientID = "fsq-" + host
+	}
+
+	terp := setup()
+	client := &mqttClient{
+		Broker:    *broker,
+		ClientID:  *clientID,
+		Username:  *username,
+		Password:  *password,
+		KeepAlive: *keepalive,
+		Timeout:   10 * time.Second,
+	}
+
+	backoff := time.Second
+	for {
+		if !client.connected() {
+			if err := client.Connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "mqtt: connecting to %s: %s; retrying in %s\n", *broker, err, backoff)
+				time.Sleep(backoff)
+				if backoff < time.Minute {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = time.Second
+			// republish everything after a reconnect
+			for _, t := range topics {
+				t.last = nil
+			}
+		}
+
+		now := time.Now()
+		next := now.Add(time.Minute)
+		if *keepalive > 0 && *keepalive/2 < time.Minute {
+			next = now.Add(*keepalive / 2)
+		}
+		for _, t := range topics {
+			if now.Before(t.next) {
+				if t.next.Before(next) {
+					next = t.next
+				}
+				continue
+			}
+			t.next = now.Add(t.Interval)
+			if t.next.Before(next) {
+				next = t.next
+			}
+
+			payload, err := topicPayload(terp, t.Expr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "mqtt: %s: %s\n", t.Expr, err)
+				continue
+			}
+			if t.Change && bytes.Equal(payload, t.last) {
+				continue
+			}
+
+			if err := client.Publish(t.Topic, t.QoS, t.Retain, payload); err != nil {
+				fmt.Fprintf(os.Stderr, "mqtt: publishing %s: %s\n", t.Topic, err)
+				t.next = time.Time{}
+				client.Close()
+				break
+			}
+			t.last = payload
+		}
+
+		if client.connected() {
+			if err := client.Ping(); err != nil {
+				fmt.Fprintln(os.Stderr, "mqtt: ping:", err)
+				client.Close()
+			}
+		}
+		time.Sleep(time.Until(next))
+	}
+}
+
+func topicPayload(terp *interpreter, expr string) ([]byte, error) {
+	v, err := terp.Eval(expr)
+	if err != nil {
+		return nil, err
+	}
+	if !v.IsValid() {
+		return nil, errors.New("expression has no value")
+	}
+	return json.Marshal(constDemote(v).Interface())
+}
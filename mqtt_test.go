@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A stubBroker accepts one connection and records the packets it gets,
+// acknowledging CONNECT and QoS 1 PUBLISH packets
+type stubBroker struct {
+	ln      net.Listener
+	packets chan stubPacket
+}
+
+type stubPacket struct {
+	typ, flags byte
+	body       []byte
+}
+
+func newStubBroker(t *testing.T) *stubBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &stubBroker{ln: ln, packets: make(chan stubPacket, 10)}
+	go b.serve()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *stubBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *stubBroker) serve() {
+	conn, err := b.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer close(b.packets)
+
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		n, mult := 0, 1
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			n += int(c&0x7f) * mult
+			mult *= 128
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+		p := stubPacket{header >> 4, header & 0x0f, body}
+		b.packets <- p
+
+		switch {
+		case p.typ == mqttConnect:
+			conn.Write([]byte{mqttConnack << 4, 2, 0, 0})
+		case p.typ == mqttPublish && p.flags&0x06 == 0x02:
+			l := int(binary.BigEndian.Uint16(body))
+			conn.Write(append([]byte{mqttPuback << 4, 2}, body[2+l:4+l]...))
+		}
+	}
+}
+
+func (b *stubBroker) next(t *testing.T) stubPacket {
+	t.Helper()
+	select {
+	case p, ok := <-b.packets:
+		if !ok {
+			t.Fatal("broker connection closed")
+		}
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a packet")
+	}
+	return stubPacket{}
+}
+
+func TestMQTTPublish(t *testing.T) {
+	b := newStubBroker(t)
+	c := &mqttClient{
+		Broker:    b.url(),
+		ClientID:  "fsq-test",
+		Username:  "oper",
+		Password:  "secret",
+		KeepAlive: time.Minute,
+		Timeout:   5 * time.Second,
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := b.next(t)
+	if p.typ != mqttConnect {
+		t.Fatalf("got packet type %d, want CONNECT", p.typ)
+	}
+	// 6 bytes of protocol name, then level, flags and keep alive
+	if flags := p.body[7]; flags != 0xc2 {
+		t.Errorf("connect flags = %#x, want 0xc2", flags)
+	}
+	if payload := string(p.body[10:]); payload != "\x00\x08fsq-test\x00\x04oper\x00\x06secret" {
+		t.Errorf("connect payload = %q", payload)
+	}
+
+	if err := c.Publish("station/fs/source", 1, true, []byte(`"3C84"`)); err != nil {
+		t.Fatal(err)
+	}
+	p = b.next(t)
+	if p.typ != mqttPublish || p.flags != 0x03 {
+		t.Fatalf("got packet type %d flags %#x, want PUBLISH QoS 1 retained", p.typ, p.flags)
+	}
+	if want := "\x00\x11station/fs/source\x00\x01\"3C84\""; string(p.body) != want {
+		t.Errorf("publish body = %q, want %q", p.body, want)
+	}
+}
+
+func TestMQTTPasswordNeedsUser(t *testing.T) {
+	c := &mqttClient{Broker: "tcp://127.0.0.1:1", Password: "secret", Timeout: time.Second}
+	if err := c.Connect(); err == nil || !strings.Contains(err.Error(), "user name") {
+		t.Errorf("Connect with a password and no user name: got %v", err)
+	}
+}
+
+func TestReadTopics(t *testing.T) {
+	const src = `# fsq topics
+topics:
+  - topic: "station/#"   # all of it
+    expr: 'sprintf("%s #%d", "a", 1)'
+    qos: 1
+    interval: 5s
+  - topic: station/fs/source#1
+    expr: str(fs.lsorna)
+`
+	topics, err := readTopics(strings.NewReader(src), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 2 {
+		t.Fatalf("got %d topics, want 2", len(topics))
+	}
+	if got := topics[0].Topic; got != "station/#" {
+		t.Errorf("topic = %q", got)
+	}
+	if got := topics[0].Expr; got != `sprintf("%s #%d", "a", 1)` {
+		t.Errorf("expr = %q", got)
+	}
+	if topics[0].QoS != 1 || topics[0].Interval != 5*time.Second {
+		t.Errorf("qos, interval = %d, %s", topics[0].QoS, topics[0].Interval)
+	}
+	if got := topics[1].Topic; got != "station/fs/source#1" {
+		t.Errorf("topic = %q", got)
+	}
+	if topics[1].Interval != 10*time.Second {
+		t.Errorf("default interval = %s", topics[1].Interval)
+	}
+}
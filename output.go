@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An encoder writes the value v of the expression label to w
+type encoder func(w io.Writer, label string, v reflect.Value) error
+
+var encoders = map[string]encoder{
+	"json":   encodeJSON,
+	"influx": encodeInflux,
+	"fslog":  encodeFSLog,
+	"table":  encodeTable,
+	"csv":    encodeCSV,
+}
+
+var (
+	indent string // used to indent JSON output
+	depth  int    // deepest nesting shown in JSON output, if positive
+	color  bool   // highlight JSON output
+)
+
+// A setting is an output option, changed in a session with :set
+type setting struct {
+	help string
+	get  func() string
+	set  func(string) error
+}
+
+var settings = map[string]setting{
+	"indent": {
+		"spaces to indent JSON output by, 0 for none",
+		func() string { return strconv.Itoa(len(indent)) },
+		func(s string) error {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return fmt.Errorf("bad indent %q", s)
+			}
+			indent = strings.Repeat(" ", n)
+			return nil
+		},
+	},
+	"depth": {
+		"deepest nesting shown in JSON output, 0 for all",
+		func() string { return strconv.Itoa(depth) },
+		func(s string) error {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return fmt.Errorf("bad depth %q", s)
+			}
+			depth = n
+			return nil
+		},
+	},
+	"color": {
+		"highlight JSON output, on or off",
+		func() string { return onOff(color) },
+		func(s string) (err error) {
+			color, err = parseOnOff(s)
+			return err
+		},
+	},
+	"enums": {
+		"show the names of enum codes in JSON, table and CSV output, on or off",
+		func() string { return onOff(showEnums) },
+		func(s string) (err error) {
+			if showEnums, err = parseOnOff(s); err != nil {
+				return err
+			}
+			return loadEnums()
+		},
+	},
+	"hex": {
+		"show integers in JSON, table and CSV output in hex, on or off",
+		func() string { return onOff(hexInts) },
+		func(s string) (err error) {
+			hexInts, err = parseOnOff(s)
+			return err
+		},
+	},
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func parseOnOff(s string) (bool, error) {
+	switch s {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", s)
+}
+
+func encodeJSON(w io.Writer, label string, v reflect.Value) error {
+	if cv, ok := v.Interface().(constant.Value); ok {
+		if hexInts && cv.Kind() == constant.Int {
+			_, err := fmt.Fprintln(w, hex(cv))
+			return err
+		}
+		_, err := fmt.Fprintln(w, cv)
+		return err
+	}
+
+	val := v.Interface()
+	if depth > 0 || hexInts || showEnums {
+		d := depth
+		if d == 0 {
+			d = -1
+		}
+		val = truncatePath(v, d, labelPath(label))
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(val); err != nil {
+		return err
+	}
+
+	out := buf.Bytes()
+	if color {
+		out = colorJSON(out)
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// labelPath is the json path of the field the expression label selects,
+// for finding its enum
+func labelPath(label string) []string {
+	exp, err := parseExpr(label)
+	if err != nil {
+		return nil
+	}
+	return fieldPath(exp)
+}
+
+// An object is a JSON object that keeps its members in order
+type object []member
+
+type member struct {
+	name  string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(m.name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// truncate copies v for encoding, summarising structs, arrays and maps
+// nested deeper than depth, if it isn't negative. Integers are converted to
+// hex strings if hexInts is set, and enum codes are named if showEnums is.
+func truncate(v reflect.Value, depth int) interface{} {
+	return truncatePath(v, depth, nil)
+}
+
+// truncatePath is truncate for a value at the json path, for finding enums
+func truncatePath(v reflect.Value, depth int, path []string) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	if t := v.Type(); t.Implements(marshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	if _, ok := v.Interface().(constant.Value); ok {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s := fmt.Sprint(v.Interface())
+		if hexInts {
+			s = hex(v.Interface()).(string)
+		}
+		if showEnums {
+			if name, ok := enumName(v, path); ok {
+				return s + " (" + name + ")"
+			}
+		}
+		if hexInts {
+			return s
+		}
+	case reflect.Struct:
+		if depth == 0 {
+			return fmt.Sprintf("{%d fields}", v.NumField())
+		}
+		obj := object{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if s, ok := tagName(field, "json"); ok && s != "" {
+				name = s
+			}
+			if name == "-" {
+				continue
+			}
+			obj = append(obj, member{name, truncatePath(v.Field(i), depth-1, append(path[:len(path):len(path)], name))})
+		}
+		return obj
+	case reflect.Array, reflect.Slice:
+		if isCString(v.Type()) {
+			return cstr(v.Interface())
+		}
+		if depth == 0 {
+			return fmt.Sprintf("[%d items]", v.Len())
+		}
+		a := make([]interface{}, v.Len())
+		for i := range a {
+			a[i] = truncatePath(v.Index(i), depth-1, path)
+		}
+		return a
+	case reflect.Map:
+		if depth == 0 {
+			return fmt.Sprintf("{%d keys}", v.Len())
+		}
+		keys := sortedKeys(v)
+		obj := object{}
+		for _, key := range keys {
+			obj = append(obj, member{fmt.Sprint(key), truncatePath(v.MapIndex(key), depth-1, append(path[:len(path):len(path)], fmt.Sprint(key)))})
+		}
+		return obj
+	}
+	return v.Interface()
+}
+
+// ANSI colours for JSON output
+const (
+	colorKey    = "\x1b[34m"
+	colorString = "\x1b[32m"
+	colorNumber = "\x1b[36m"
+	colorLit    = "\x1b[35m"
+	colorReset  = "\x1b[0m"
+)
+
+// colorJSON highlights the keys and values of encoded JSON
+func colorJSON(b []byte) []byte {
+	var out bytes.Buffer
+	span := func(col string, i, j int) int {
+		out.WriteString(col)
+		out.Write(b[i:j])
+		out.WriteString(colorReset)
+		return j
+	}
+
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < len(b) && b[j] != '"' {
+				if b[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(b) {
+				j++
+			}
+			k := j
+			for k < len(b) && (b[k] == ' ' || b[k] == '\n' || b[k] == '\t') {
+				k++
+			}
+			if k < len(b) && b[k] == ':' {
+				i = span(colorKey, i, j)
+			} else {
+				i = span(colorString, i, j)
+			}
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(b) && strings.IndexByte("+-.eE0123456789", b[j]) != -1 {
+				j++
+			}
+			i = span(colorNumber, i, j)
+		case c >= 'a' && c <= 'z':
+			j := i + 1
+			for j < len(b) && b[j] >= 'a' && b[j] <= 'z' {
+				j++
+			}
+			i = span(colorLit, i, j)
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes()
+}
+
+// display writes the result of evaluating label to w in format
+func display(w io.Writer, format, label string, value reflect.Value) {
+	if !value.IsValid() {
+		return
+	}
+
+	if _, ok := value.Interface().(special); ok {
+		fmt.Fprintln(w, "builtin, see help()")
+		return
+	}
+
+	if value.Kind() == reflect.Func {
+		if value.Type().NumIn() == 0 && value.Type().NumOut() == 0 {
+			value.Call([]reflect.Value{})
+			return
+		}
+		fmt.Fprintln(w, value.Type())
+		return
+	}
+
+	enc, ok := encoders[format]
+	if !ok {
+		fmt.Fprintf(w, "error: unknown output format %q\n", format)
+		return
+	}
+	values := []reflect.Value{value}
+	if jqProgram != "" {
+		var err error
+		if values, err = runJQ(value, jqProgram); err != nil {
+			fmt.Fprintln(w, "error:", err)
+			return
+		}
+	}
+	for _, v := range values {
+		if err := encode(enc, w, label, v); err != nil {
+			fmt.Fprintln(w, "error:", err)
+		}
+	}
+}
+
+// encode writes v with enc, returning a panic in encoding as an error so a
+// value that can't be encoded doesn't end the session
+func encode(enc encoder, w io.Writer, label string, v reflect.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("can't encode %s: %v", label, r)
+		}
+	}()
+	return enc(w, label, v)
+}
+
+// isCString reports if values of type t are treated as C strings
+func isCString(t reflect.Type) bool {
+	return (t.Kind() == reflect.Array || t.Kind() == reflect.Slice) && t.Elem().Kind() == reflect.Uint8
+}
+
+// walk calls fn with each leaf value under v and the path of names leading
+// to it. Struct fields are named by the struct tag key tag, if non-empty.
+// C strings, times and constants are leaves.
+func walk(v reflect.Value, tag string, path []string, fn func(path []string, v reflect.Value)) {
+	if !v.IsValid() {
+		return
+	}
+	if v.CanInterface() {
+		if _, ok := v.Interface().(constant.Value); ok {
+			fn(path, v)
+			return
+		}
+	}
+	if v.Type() == timeType {
+		fn(path, v)
+		return
+	}
+
+	// force a copy so fn may keep path
+	path = path[:len(path):len(path)]
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walk(v.Elem(), tag, path, fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := field.Name
+			if tag != "" {
+				s, ok := tagName(field, tag)
+				if !ok || s == "-" {
+					continue
+				}
+				name = s
+			}
+			walk(v.Field(i), tag, append(path, name), fn)
+		}
+	case reflect.Array, reflect.Slice:
+		if isCString(v.Type()) {
+			fn(path, v)
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), tag, append(path, strconv.Itoa(i)), fn)
+		}
+	case reflect.Map:
+		keys := sortedKeys(v)
+		for _, key := range keys {
+			walk(v.MapIndex(key), tag, append(path, fmt.Sprint(key)), fn)
+		}
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+	default:
+		fn(path, v)
+	}
+}
+
+// sortedKeys returns the keys of the map v, in order of their text
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
+
+// exprName gives a short name for the expression src: the last field or
+// variable it selects
+func exprName(src string) string {
+	exp, err := parseExpr(src)
+	if err != nil {
+		return ""
+	}
+	return astName(exp)
+}
+
+// labelName is exprName, with a default for unnamed expressions
+func labelName(label string) string {
+	if name := exprName(label); name != "" {
+		return name
+	}
+	return "fsq"
+}
+
+func astName(exp ast.Expr) string {
+	for {
+		switch e := exp.(type) {
+		case *ast.Ident:
+			return e.Name
+		case *ast.SelectorExpr:
+			return e.Sel.Name
+		case *ast.IndexExpr:
+			exp = e.X
+		case *ast.SliceExpr:
+			exp = e.X
+		case *ast.ParenExpr:
+			exp = e.X
+		case *ast.StarExpr:
+			exp = e.X
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var queryBuiltins = []builtin{
+	{"q", special(queryOf), "q(query)", "rows of a query, eg \"select name, freq from fs.bbc where freq > 500 order by freq desc limit 5\""},
+}
+
+// A query selects columns from the elements of an array or slice of
+// structs, like SQL:
+//
+//	select cols from xs [where cond] [order by exp [asc|desc], ...] [limit n]
+//
+// The columns, condition and order are expressions of the fields of each
+// element, by json name, with C strings as strings. Expressions are Go,
+// except that '=' and '<>' compare, 'and', 'or' and 'not' are logical
+// operators, and single quotes give strings.
+type query struct {
+	columns []queryColumn // nil for *
+	from    ast.Expr
+	where   ast.Expr
+	order   []queryOrder
+	limit   ast.Expr
+}
+
+// A queryColumn is a selected expression, named by its alias or field
+type queryColumn struct {
+	name string
+	exp  ast.Expr
+}
+
+// A queryOrder is an expression rows are sorted by
+type queryOrder struct {
+	exp  ast.Expr
+	desc bool
+}
+
+// queryClauses are the keywords starting the clauses of a query
+var queryClauses = map[string]bool{"select": true, "from": true, "where": true, "order": true, "limit": true}
+
+// parseQuery parses src, panicking if it isn't a query
+func parseQuery(src string) *query {
+	lexemes, _ := lex(src)
+
+	// split into clauses, at keywords outside brackets
+	clauses := map[string][]lexeme{}
+	var order []string
+	clause, depth := "", 0
+	for i := 0; i < len(lexemes); i++ {
+		l := lexemes[i]
+		switch l.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.IDENT, token.SELECT:
+			kw := strings.ToLower(l.lit)
+			if depth != 0 || !queryClauses[kw] {
+				break
+			}
+			if kw == "order" {
+				if i+1 == len(lexemes) || !strings.EqualFold(lexemes[i+1].lit, "by") {
+					panic("expected by after order")
+				}
+				i++
+			}
+			if _, ok := clauses[kw]; ok {
+				panic(fmt.Errorf("more than one %s clause", kw))
+			}
+			clause = kw
+			clauses[kw] = []lexeme{}
+			order = append(order, kw)
+			continue
+		}
+		if clause == "" {
+			panic("query must start with select")
+		}
+		clauses[clause] = append(clauses[clause], l)
+	}
+
+	if len(order) < 2 || order[0] != "select" || order[1] != "from" {
+		panic("query must start with select ... from")
+	}
+	for i, kw := range order {
+		if i > 0 && queryRank(kw) < queryRank(order[i-1]) {
+			panic(fmt.Errorf("%s clause after %s", kw, order[i-1]))
+		}
+		if len(clauses[kw]) == 0 {
+			panic(fmt.Errorf("empty %s clause", kw))
+		}
+	}
+
+	q := &query{}
+	q.from = queryExpr(src, clauses["from"])
+	if where, ok := clauses["where"]; ok {
+		q.where = queryExpr(src, where)
+	}
+	if limit, ok := clauses["limit"]; ok {
+		q.limit = queryExpr(src, limit)
+	}
+
+	sel := clauses["select"]
+	if len(sel) != 1 || sel[0].tok != token.MUL {
+		names := map[string]int{}
+		for i, item := range splitLexemes(sel) {
+			col := queryColumn{}
+			if n := len(item); n > 2 && item[n-2].tok == token.IDENT && strings.EqualFold(item[n-2].lit, "as") {
+				col.name = item[n-1].lit
+				if item[n-1].tok == token.STRING || item[n-1].tok == token.CHAR {
+					col.name = item[n-1].lit[1 : len(item[n-1].lit)-1]
+				}
+				item = item[:n-2]
+			}
+			col.exp = queryExpr(src, item)
+			if col.name == "" {
+				switch col.exp.(type) {
+				case *ast.Ident, *ast.SelectorExpr:
+					col.name = astName(col.exp)
+				default:
+					// the expression, if it can be a json name
+					col.name = src[item[0].off:item[len(item)-1].end]
+					if strings.ContainsAny(col.name, "\"'\\,`") {
+						col.name = "col" + strconv.Itoa(i+1)
+					}
+				}
+			}
+			if names[col.name]++; names[col.name] > 1 {
+				col.name += "_" + strconv.Itoa(names[col.name])
+			}
+			q.columns = append(q.columns, col)
+		}
+	}
+
+	for _, item := range splitLexemes(clauses["order"]) {
+		o := queryOrder{}
+		if n := len(item); n > 1 && item[n-1].tok == token.IDENT {
+			switch strings.ToLower(item[n-1].lit) {
+			case "desc":
+				o.desc = true
+				item = item[:n-1]
+			case "asc":
+				item = item[:n-1]
+			}
+		}
+		o.exp = queryExpr(src, item)
+		q.order = append(q.order, o)
+	}
+	return q
+}
+
+// queryRank is the position of the clause kw in a query
+func queryRank(kw string) int {
+	return strings.Index("select from where order limit", kw)
+}
+
+// splitLexemes splits lexemes at commas outside brackets
+func splitLexemes(lexemes []lexeme) [][]lexeme {
+	var items [][]lexeme
+	start, depth := 0, 0
+	for i, l := range lexemes {
+		switch l.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.COMMA:
+			if depth == 0 {
+				items = append(items, lexemes[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if len(lexemes) > 0 {
+		items = append(items, lexemes[start:])
+	}
+	for _, item := range items {
+		if len(item) == 0 {
+			panic("missing expression")
+		}
+	}
+	return items
+}
+
+// queryExpr parses the lexemes of src as an expression, after changing
+// the SQL operators to Go. NOT applies to the rest of its condition, up to
+// the next AND or OR, as it binds less tightly than comparisons.
+func queryExpr(src string, lexemes []lexeme) ast.Expr {
+	var b strings.Builder
+	depth := 0
+	var nots []int // depths of the NOTs not yet closed
+	closeNots := func(d int) {
+		for len(nots) > 0 && nots[len(nots)-1] >= d {
+			b.WriteByte(')')
+			nots = nots[:len(nots)-1]
+		}
+	}
+
+	for i := 0; i < len(lexemes); i++ {
+		l := lexemes[i]
+		word := ""
+		if l.tok == token.IDENT {
+			word = strings.ToLower(l.lit)
+		}
+		switch {
+		case word == "and" || word == "or":
+			closeNots(depth)
+		case l.tok == token.RPAREN || l.tok == token.RBRACK || l.tok == token.RBRACE:
+			closeNots(depth)
+			depth--
+		}
+
+		if i > 0 {
+			b.WriteString(src[lexemes[i-1].end:l.off])
+		}
+		text := src[l.off:l.end]
+		switch l.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.ASSIGN:
+			text = "=="
+		case token.LSS:
+			if i+1 < len(lexemes) && lexemes[i+1].tok == token.GTR && lexemes[i+1].off == l.end {
+				text = "!="
+				i++
+			}
+		case token.CHAR:
+			text = strconv.Quote(strings.ReplaceAll(text[1:len(text)-1], "''", "'"))
+		}
+		switch word {
+		case "and":
+			text = "&&"
+		case "or":
+			text = "||"
+		case "not":
+			text = "!("
+			nots = append(nots, depth)
+		}
+		b.WriteString(text)
+	}
+	closeNots(0)
+
+	exp, err := parseExpr(b.String())
+	if err != nil {
+		panic(fmt.Errorf("%s: %s", b.String(), err))
+	}
+	return exp
+}
+
+// rowScope binds the fields of the struct e by json name, with C strings
+// as strings
+func (terp *interpreter) rowScope(e reflect.Value) map[string]reflect.Value {
+	scope := map[string]reflect.Value{}
+	for i := 0; i < e.NumField(); i++ {
+		field := e.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if terp.Tag != "" {
+			s, ok := tagName(field, terp.Tag)
+			if !ok || s == "-" {
+				continue
+			}
+			name = s
+		}
+		v := e.Field(i)
+		if isCString(v.Type()) {
+			v = reflect.ValueOf(cstr(v.Interface()))
+		}
+		scope[name] = v
+	}
+	return scope
+}
+
+// evalIn evaluates exp in scopes, demoting a constant and dereferencing a
+// pointer to a field
+func (terp *interpreter) evalIn(exp ast.Expr, scopes ...map[string]reflect.Value) reflect.Value {
+	terp.locals = append(terp.locals, scopes...)
+	defer func() {
+		terp.locals = terp.locals[:len(terp.locals)-len(scopes)]
+	}()
+
+	v := terp.eval(exp)
+	if !v.IsValid() {
+		return v
+	}
+	return deref(constDemote(v))
+}
+
+// runQuery evaluates q, giving a slice of structs with a field for each
+// column
+func (terp *interpreter) runQuery(q *query) reflect.Value {
+	from := deref(terp.eval(q.from))
+	if !from.IsValid() || !keyed(from) {
+		panic(fmt.Errorf("%s is not an array or slice of structs", expfmt(q.from)))
+	}
+
+	type row struct {
+		elem  reflect.Value
+		scope map[string]reflect.Value
+		cols  []reflect.Value
+		keys  []constant.Value
+	}
+	var rows []*row
+	for i := 0; i < from.Len(); i++ {
+		e := deref(from.Index(i))
+		if !e.IsValid() {
+			continue
+		}
+		r := &row{elem: e, scope: terp.rowScope(e)}
+		if q.where != nil && !truth(terp.evalIn(q.where, r.scope)) {
+			continue
+		}
+		rows = append(rows, r)
+	}
+
+	// columns, also usable in the order by their names
+	for _, r := range rows {
+		names := map[string]reflect.Value{}
+		for _, col := range q.columns {
+			v := terp.evalIn(col.exp, r.scope)
+			r.cols = append(r.cols, v)
+			names[col.name] = v
+		}
+		for _, o := range q.order {
+			r.keys = append(r.keys, sortKey(terp.evalIn(o.exp, r.scope, names)))
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, o := range q.order {
+			a, b := rows[i].keys[k], rows[j].keys[k]
+			if !compatible(a, b) {
+				panic(fmt.Errorf("can't compare %s and %s", a.Kind(), b.Kind()))
+			}
+			if constant.Compare(a, token.EQL, b) {
+				continue
+			}
+			return constant.Compare(a, token.LSS, b) != o.desc
+		}
+		return false
+	})
+
+	if q.limit != nil {
+		if n := queryLimit(terp.eval(q.limit)); n < len(rows) {
+			rows = rows[:n]
+		}
+	}
+
+	if q.columns == nil {
+		out := reflect.MakeSlice(reflect.SliceOf(from.Type().Elem()), len(rows), len(rows))
+		for i, r := range rows {
+			out.Index(i).Set(r.elem)
+		}
+		return out
+	}
+
+	// a field per column, of the type of all its values if they share one
+	names := make([]string, len(q.columns))
+	types := make([]reflect.Type, len(q.columns))
+	for c, col := range q.columns {
+		vals := make([]reflect.Value, len(rows))
+		for i, r := range rows {
+			vals[i] = r.cols[c]
+		}
+		names[c] = col.name
+		types[c] = sliceOf(vals).Type().Elem()
+	}
+	t := recordType(names, types)
+
+	out := reflect.MakeSlice(reflect.SliceOf(t), len(rows), len(rows))
+	for i, r := range rows {
+		for c, v := range r.cols {
+			if v.IsValid() {
+				out.Index(i).Field(c).Set(v)
+			}
+		}
+	}
+	return out
+}
+
+// queryLimit is the number of rows v limits a query to
+func queryLimit(v reflect.Value) int {
+	if !v.IsValid() {
+		panic("limit must be an integer")
+	}
+	x := constPromote(v)
+	c := constant.ToInt(x)
+	if c.Kind() != constant.Int {
+		panic(fmt.Errorf("limit must be an integer, not %s", x))
+	}
+	n, exact := constant.Int64Val(c)
+	if !exact || n < 0 || int64(int(n)) != n {
+		panic(fmt.Errorf("limit must be a non-negative integer, not %s", c))
+	}
+	return int(n)
+}
+
+// recordType is a struct type with fields of types, with json names names
+func recordType(names []string, types []reflect.Type) reflect.Type {
+	fields := make([]reflect.StructField, len(names))
+	for i, name := range names {
+		fields[i] = reflect.StructField{
+			Name: "F" + strconv.Itoa(i),
+			Type: types[i],
+			Tag:  reflect.StructTag("json:" + strconv.Quote(name)),
+		}
+	}
+	return reflect.StructOf(fields)
+}
+
+// queryOf(query) runs the query
+func queryOf(terp *interpreter, args []ast.Expr) reflect.Value {
+	if len(args) != 1 {
+		panic("q takes one argument")
+	}
+	return terp.runQuery(parseQuery(text(terp.eval(args[0]))))
+}
+
+// sqlQuery is the expression running the query src
+func sqlQuery(src string) string {
+	return "q(" + strconv.Quote(strings.TrimSpace(src)) + ")"
+}
+
+func sqlMain(args []string) {
+	outputFormat = "table"
+	flags := flag.NewFlagSet("sql", flag.ExitOnError)
+	flags.StringVar(&outputFormat, "o", outputFormat, "output `format`: table, csv, json, influx or fslog")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsq sql [flags] [query...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	terp := setup()
+	if flags.NArg() > 0 {
+		exps := make([]string, flags.NArg())
+		for i, q := range flags.Args() {
+			exps[i] = sqlQuery(q)
+		}
+		run(terp, exps)
+		return
+	}
+
+	if _, ok := encoders[outputFormat]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", outputFormat)
+		os.Exit(2)
+	}
+	s := newSession(terp)
+	s.sql = true
+	defer s.Close()
+	s.repl()
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestQuery(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `q("select freq from fs.bbc where freq > 150 and freq < 350")`, want: `[{"freq":200},{"freq":300}]`},
+		{src: `q("select freq from fs.bbc where freq = 100 or freq = 400")`, want: `[{"freq":100},{"freq":400}]`},
+		{src: `q("select freq from fs.bbc where freq <> 200 and not freq > 300")`, want: `[{"freq":100},{"freq":300}]`},
+		{src: `q("select name from fs.bbc where not freq > 350")`, want: `[{"name":"a   "},{"name":"b   "},{"name":"3C84"}]`},
+		{src: `q("select freq from fs.bbc where not (freq > 150 and freq < 350) or freq = 200")`, want: `[{"freq":100},{"freq":200},{"freq":400}]`},
+		{src: `q("select freq from fs.bbc where not not freq = 100")`, want: `[{"freq":100}]`},
+		{src: `q("select freq from fs.bbc where name = '3C84'")`, want: `[{"freq":300}]`},
+		{src: `q("select freq, bw[1] as b from fs.bbc order by freq desc limit 2")`, want: `[{"freq":400,"b":8},{"freq":300,"b":8}]`},
+		{src: `q("select freq from fs.bbc order by freq % 300, freq desc")`, want: `[{"freq":300},{"freq":400},{"freq":100},{"freq":200}]`},
+		{src: `q("select freq / 100 from fs.bbc limit 0")`, want: `[]`},
+		{src: `q("select freq from fs.bbc limit -1")`, err: "limit must be a non-negative integer"},
+		{src: `q("select freq from fs.bbc limit 1.5")`, err: "limit must be an integer"},
+		{src: `q("select freq where freq > 1")`, err: "query must start with select ... from"},
+		{src: `q("select freq from fs.bbc limit 1 where freq > 1")`, err: "where clause after limit"},
+	})
+}
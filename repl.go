@@ -0,0 +1,434 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peterh/liner"
+)
+
+// A session is an interactive fsq session
+type session struct {
+	terp   *interpreter
+	lr     *liner.State
+	hist   *history
+	timing bool // show how long evaluations take
+	sql    bool // lines are queries, as for q
+	quit   bool
+}
+
+// A metaCommand is a session command, entered with a leading ':'
+type metaCommand struct {
+	args string
+	help string
+	run  func(s *session, args []string) error
+}
+
+var metaCommands map[string]metaCommand
+
+func init() {
+	metaCommands = map[string]metaCommand{
+		"help":      {"", "list commands", (*session).help},
+		"quit":      {"", "end the session", (*session).exit},
+		"format":    {"[format]", "show or set the output format", (*session).format},
+		"set":       {"[setting value]", "show or change output settings", (*session).set},
+		"load":      {"file", "evaluate the statements in file", (*session).load},
+		"save":      {"file", "save user definitions to file, replacing it", (*session).save},
+		"reload":    {"", "evaluate the init files again", (*session).reload},
+		"time":      {"", "toggle showing how long evaluations take", (*session).time},
+		"clear":     {"", "clear the screen", (*session).clear},
+		"reconnect": {"", "attach to the FS shared memory again", (*session).reconnect},
+		"history":   {"[text]", "list history, or the entries containing text", (*session).showHistory},
+		"!":         {"n", "run history entry n again", (*session).rerun},
+	}
+}
+
+func newSession(terp *interpreter) *session {
+	s := &session{
+		terp: terp,
+		lr:   liner.NewLiner(),
+	}
+	s.lr.SetCtrlCAborts(true)
+
+	s.lr.SetCompleter(func(line string) []string {
+		if strings.HasPrefix(line, ":") {
+			return completeMeta(line)
+		}
+		return complete(terp, line)
+	})
+
+	if liner.TerminalSupported() {
+		indent = " "
+	}
+
+	path, err := historyPath()
+	if err == nil {
+		s.hist, err = newHistory(path)
+		s.lr.ReadHistory(strings.NewReader(strings.Join(s.hist.entries, "\n")))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "history:", err)
+	}
+	return s
+}
+
+func (s *session) Close() error {
+	if s.hist != nil {
+		if err := s.hist.compact(); err != nil {
+			fmt.Fprintln(os.Stderr, "history:", err)
+		}
+	}
+	return s.lr.Close()
+}
+
+// record adds line to the history
+func (s *session) record(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	s.lr.AppendHistory(line)
+	if s.hist == nil {
+		return
+	}
+	if err := s.hist.add(line); err != nil {
+		fmt.Fprintln(os.Stderr, "history:", err)
+	}
+}
+
+// repl reads and evaluates input until the end of input or :quit. Input
+// continues onto the next line while it is part way through a statement.
+func (s *session) repl() {
+	input := ""
+	for !s.quit {
+		prompt := "> "
+		if input != "" {
+			prompt = ". "
+		}
+
+		line, err := s.lr.Prompt(prompt)
+		if err == liner.ErrPromptAborted {
+			input = ""
+			continue
+		}
+		if err != nil { // io.EOF
+			break
+		}
+
+		if input == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !strings.HasPrefix(strings.TrimSpace(line), ":!") {
+				s.record(line)
+			}
+			s.meta(line)
+			continue
+		}
+
+		input += line + "\n"
+		_, complete, err := statements(input)
+		if err != nil && !s.sql {
+			if !strings.Contains(strings.TrimSuffix(input, "\n"), "\n") {
+				s.record(line)
+			}
+			fmt.Println("error:", err)
+			input = ""
+			continue
+		}
+		if !complete && !s.sql {
+			continue
+		}
+		s.record(oneLine(input))
+		s.exec(input)
+		input = ""
+	}
+}
+
+// exec evaluates and displays the statements of src, or runs it if it is
+// a meta command
+func (s *session) exec(src string) {
+	if strings.HasPrefix(strings.TrimSpace(src), ":") {
+		s.meta(src)
+		return
+	}
+	if s.sql {
+		src = sqlQuery(src)
+	}
+
+	stmts, _, _ := statements(src)
+	for _, stmt := range stmts {
+		start := time.Now()
+		value, err := s.terp.Eval(stmt.src)
+		if err != nil {
+			fmt.Println("error:", err)
+			continue
+		}
+		display(os.Stdout, outputFormat, stmt.src, value)
+		if s.timing {
+			fmt.Printf("(%s)\n", time.Since(start).Round(time.Microsecond))
+		}
+	}
+}
+
+func (s *session) meta(line string) {
+	fields := strings.Fields(strings.TrimSpace(line)[1:])
+	if len(fields) == 0 {
+		return
+	}
+	if name := fields[0]; len(name) > 1 && name[0] == '!' {
+		// :!n
+		fields = append([]string{"!", name[1:]}, fields[1:]...)
+	}
+
+	cmd, ok := metaCommands[fields[0]]
+	if !ok {
+		fmt.Printf("error: unknown command :%s\n", fields[0])
+		return
+	}
+	if err := cmd.run(s, fields[1:]); err != nil {
+		fmt.Println("error:", err)
+	}
+}
+
+func (s *session) help(args []string) error {
+	names := make([]string, 0, len(metaCommands))
+	for name := range metaCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := metaCommands[name]
+		fmt.Printf("  %-22s %s\n", ":"+name+" "+cmd.args, cmd.help)
+	}
+	return nil
+}
+
+func (s *session) exit(args []string) error {
+	s.quit = true
+	return nil
+}
+
+func (s *session) format(args []string) error {
+	switch len(args) {
+	case 0:
+		fmt.Printf("%s (available: %s)\n", outputFormat, strings.Join(formatNames(), ", "))
+	case 1:
+		if _, ok := encoders[args[0]]; !ok {
+			return fmt.Errorf("unknown output format %q", args[0])
+		}
+		outputFormat = args[0]
+	default:
+		return errors.New("usage: :format [format]")
+	}
+	return nil
+}
+
+func formatNames() []string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func settingNames() []string {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *session) set(args []string) error {
+	switch len(args) {
+	case 0:
+		for _, name := range settingNames() {
+			fmt.Printf("  %-8s %-6s %s\n", name, settings[name].get(), settings[name].help)
+		}
+		return nil
+	case 2:
+		opt, ok := settings[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", args[0])
+		}
+		return opt.set(args[1])
+	}
+	return errors.New("usage: :set [setting value]")
+}
+
+func (s *session) load(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: :load file")
+	}
+	return load(s.terp, args[0])
+}
+
+func (s *session) time(args []string) error {
+	s.timing = !s.timing
+	fmt.Println("timing", onOff(s.timing))
+	return nil
+}
+
+func (s *session) clear(args []string) error {
+	fmt.Print("\x1b[H\x1b[2J")
+	return nil
+}
+
+func (s *session) reconnect(args []string) error {
+	return attach(s.terp)
+}
+
+// completeMeta completes meta command names, and the arguments of :format
+// and :set
+func completeMeta(line string) (c []string) {
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 || len(fields) == 1 && !strings.HasSuffix(line, " ") {
+		prefix := ""
+		if len(fields) == 1 {
+			prefix = fields[0]
+		}
+		for name := range metaCommands {
+			if strings.HasPrefix(name, prefix) {
+				c = append(c, ":"+name)
+			}
+		}
+		sort.Strings(c)
+		return c
+	}
+
+	// complete the last argument
+	done, partial := fields, ""
+	if !strings.HasSuffix(line, " ") {
+		done, partial = fields[:len(fields)-1], fields[len(fields)-1]
+	}
+
+	var candidates []string
+	switch {
+	case done[0] == "format" && len(done) == 1:
+		candidates = formatNames()
+	case done[0] == "set" && len(done) == 1:
+		candidates = settingNames()
+	}
+
+	head := ":" + strings.Join(done, " ") + " "
+	for _, cand := range candidates {
+		if strings.HasPrefix(cand, partial) {
+			c = append(c, head+cand)
+		}
+	}
+	return c
+}
+
+// save writes the definitions to the file named, replacing it. The file
+// must be named, so init files with comments and other statements aren't
+// overwritten by accident.
+func (s *session) save(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: :save file")
+	}
+	name := args[0]
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	defs := s.terp.Definitions()
+	err := os.WriteFile(name, []byte(strings.Join(append(defs, ""), "\n")), 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("saved %d definitions to %s\n", len(defs), name)
+	return nil
+}
+
+func (s *session) reload(args []string) error {
+	loadInit(s.terp)
+	return nil
+}
+
+func (s *session) showHistory(args []string) error {
+	if s.hist == nil {
+		return errors.New("no history")
+	}
+	for _, n := range s.hist.search(strings.Join(args, " ")) {
+		fmt.Printf("%5d  %s\n", n, s.hist.entries[n-1])
+	}
+	return nil
+}
+
+func (s *session) rerun(args []string) error {
+	if s.hist == nil {
+		return errors.New("no history")
+	}
+	if len(args) != 1 {
+		return errors.New("usage: :!n")
+	}
+	line, err := s.hist.get(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(line)
+	s.record(line)
+	s.exec(line)
+	return nil
+}
+
+// initFiles are the files evaluated at startup: fsq/init.fsq in the user's
+// config directory, then $FSQ_INIT
+func initFiles() []string {
+	var files []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "fsq", "init.fsq"))
+	}
+	if name := os.Getenv("FSQ_INIT"); name != "" {
+		files = append(files, name)
+	}
+	return files
+}
+
+// loadInit evaluates the init files that exist
+func loadInit(terp *interpreter) {
+	for _, name := range initFiles() {
+		err := load(terp, name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// load evaluates the statements in the named file. Errors are reported with
+// the file name and line number, and the rest of the file is still
+// evaluated.
+func load(terp *interpreter, name string) error {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	stmts, complete, err := statements(string(src))
+	bad := -1 // the statement that didn't scan
+	if e, ok := err.(*scanError); ok {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+		for i, stmt := range stmts {
+			if stmt.line <= e.pos.Line {
+				bad = i
+			}
+		}
+	}
+	for i, stmt := range stmts {
+		if !complete && i == len(stmts)-1 {
+			return fmt.Errorf("%s:%d: unexpected end of file", name, stmt.line)
+		}
+		if i == bad {
+			continue
+		}
+		if _, err := terp.Eval(stmt.src); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", name, stmt.line, err)
+		}
+	}
+	return nil
+}
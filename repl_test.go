@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		src     string
+		defined []string
+		stderr  string
+		err     string
+	}{
+		{src: "a = 1\nb = a + 1\n", defined: []string{"a", "b"}},
+		{src: "a = 1\nc = \"x\nb = 2\n", defined: []string{"a", "b"}, stderr: "init.fsq:2:5: string literal not terminated"},
+		{src: "a = 1\nc = undefined\nb = 2\n", defined: []string{"a", "b"}, stderr: "init.fsq:2: "},
+		{src: "a = 1\nf = func(x) {\n", defined: []string{"a"}, err: "init.fsq:2: unexpected end of file"},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "init.fsq")
+		if err := os.WriteFile(name, []byte(tt.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		terp := testInterp()
+		var err error
+		stderr := capture(t, &os.Stderr, func() { err = load(terp, name) })
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("load(%q): %s", tt.src, err)
+		case tt.err != "" && (err == nil || !strings.HasSuffix(err.Error(), tt.err)):
+			t.Errorf("load(%q): got error %v, want %q", tt.src, err, tt.err)
+		}
+		if tt.stderr == "" && stderr != "" || !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("load(%q) reported %q, want %q", tt.src, stderr, tt.stderr)
+		}
+		for _, v := range tt.defined {
+			if _, ok := terp.globals[v]; !ok {
+				t.Errorf("load(%q): %s not defined", tt.src, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// nonFinite notes how the encoder treats floats that JSON can't represent
+const nonFinite = "NaN and ±Inf can't be encoded; output containing them is an error instead"
+
+// jsonSchema returns the JSON Schema for values of type t as encoded by
+// fsq. path is the json path of t, used to find field descriptions.
+func jsonSchema(t reflect.Type, path []string) object {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var s object
+	if doc := fieldDocs[strings.Join(path, ".")].Doc; doc != "" {
+		s = append(s, member{"description", doc})
+	}
+
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		// can't know what it writes
+		return s
+	}
+	if t.PkgPath() == "time" && t.Name() == "Time" {
+		return append(s, member{"type", "string"}, member{"format", "date-time"})
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		s = append(s, member{"type", "boolean"})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := t.Bits()
+		s = append(s, member{"type", "integer"},
+			member{"minimum", int64(-1) << (bits - 1)},
+			member{"maximum", int64(math.MaxInt64 >> (64 - bits))})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		bits := t.Bits()
+		s = append(s, member{"type", "integer"},
+			member{"minimum", 0},
+			member{"maximum", uint64(math.MaxUint64 >> (64 - bits))})
+	case reflect.Float32, reflect.Float64:
+		s = append(s, member{"type", "number"}, member{"$comment", nonFinite})
+	case reflect.String:
+		s = append(s, member{"type", "string"})
+	case reflect.Array:
+		if isCString(t) {
+			// up to the first NUL
+			return append(s, member{"type", "string"}, member{"maxLength", t.Len()})
+		}
+		s = append(s, member{"type", "array"},
+			member{"items", jsonSchema(t.Elem(), path)},
+			member{"minItems", t.Len()},
+			member{"maxItems", t.Len()})
+	case reflect.Slice:
+		if isCString(t) {
+			return append(s, member{"type", "string"})
+		}
+		s = append(s, member{"type", []string{"array", "null"}},
+			member{"items", jsonSchema(t.Elem(), path)})
+	case reflect.Map:
+		s = append(s, member{"type", []string{"object", "null"}},
+			member{"additionalProperties", jsonSchema(t.Elem(), path)})
+	case reflect.Struct:
+		props, required := schemaFields(t, path)
+		s = append(s, member{"type", "object"},
+			member{"properties", props},
+			member{"required", required},
+			member{"additionalProperties", false})
+	}
+	return s
+}
+
+// schemaFields returns the schemas of the fields of the struct type t, and
+// the names of those always present. Untagged embedded structs are
+// flattened, as the encoder does.
+func schemaFields(t reflect.Type, path []string) (props object, required []string) {
+	props, required = object{}, []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _ := tagName(field, "json")
+		if name == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			p, r := schemaFields(field.Type, path)
+			props = append(props, p...)
+			required = append(required, r...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		props = append(props, member{name, jsonSchema(field.Type, append(path[:len(path):len(path)], name))})
+		if !strings.Contains(field.Tag.Get("json"), ",omitempty") {
+			required = append(required, name)
+		}
+	}
+	return props, required
+}
+
+func schemaMain(args []string) {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	id := flags.String("id", "", "`uri` to give as the schema's $id")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsq schema [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	s := object{{"$schema", schemaDialect}}
+	if *id != "" {
+		s = append(s, member{"$id", *id})
+	}
+	s = append(s, member{"title", "fs"})
+	s = append(s, jsonSchema(fsType(), nil)...)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		fmt.Fprintln(os.Stderr, "schema:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var searchBuiltins = []builtin{
+	{"find", special(find), "find(x, pattern)", "paths of the fields under x with names matching the glob or /regexp/ pattern"},
+	{"where", special(where), "where(x, pred)", "paths of the values under x for which pred is true"},
+}
+
+// visitPaths calls fn with the path, name and value of each field, element
+// and map entry under v. Fields are named by the struct tag key tag, if
+// non-empty, as by the interpreter.
+func visitPaths(v reflect.Value, tag, at string, fn func(at, name string, v reflect.Value)) {
+	v = deref(v)
+	if !v.IsValid() || v.Type() == timeType {
+		return
+	}
+
+	child := func(p, name string, c reflect.Value) {
+		fn(p, name, c)
+		visitPaths(c, tag, p, fn)
+	}
+	join := func(name string) string {
+		if at == "" {
+			return name
+		}
+		return at + "." + name
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if tag != "" {
+				s, ok := tagName(field, tag)
+				if !ok || s == "-" {
+					continue
+				}
+				name = s
+			}
+			child(join(name), name, v.Field(i))
+		}
+	case reflect.Array, reflect.Slice:
+		if isCString(v.Type()) {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			child(at+"["+strconv.Itoa(i)+"]", "", v.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range sortedKeys(v) {
+			k := fmt.Sprint(key)
+			child(join(k), k, v.MapIndex(key))
+		}
+	}
+}
+
+// isLeaf reports if v is a scalar, C string or time
+func isLeaf(v reflect.Value) bool {
+	v = deref(v)
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return v.Type() == timeType
+	case reflect.Array, reflect.Slice:
+		return isCString(v.Type())
+	case reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
+
+// findFields returns the paths of the fields under v with names matching
+// pattern, a glob or a /regexp/, in the order they are found
+func findFields(v reflect.Value, tag, pattern string) []string {
+	matches := func(name string) bool { return globMatch(pattern, name) }
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re := regexp.MustCompile(pattern[1 : len(pattern)-1])
+		matches = re.MatchString
+	}
+
+	paths := []string{}
+	visitPaths(v, tag, "", func(at, name string, v reflect.Value) {
+		if name != "" && matches(name) {
+			paths = append(paths, at)
+		}
+	})
+	return paths
+}
+
+// find(x, pattern) gives the paths of the fields under x with names
+// matching pattern, with the interpreter's field names
+func find(terp *interpreter, args []ast.Expr) reflect.Value {
+	if len(args) != 2 {
+		panic("find takes two arguments")
+	}
+	x := terp.eval(args[0])
+	pattern := text(terp.eval(args[1]))
+	return reflect.ValueOf(findFields(x, terp.Tag, pattern))
+}
+
+// isStrings reports if v is a string, C string or array of them
+func isStrings(v reflect.Value) bool {
+	if v.IsValid() && v.CanInterface() {
+		v = constDemote(v)
+	}
+	v = deref(v)
+	if !v.IsValid() {
+		return false
+	}
+	if v.Kind() == reflect.String || isCString(v.Type()) {
+		return true
+	}
+	if elems, ok := elements(v); ok {
+		return len(elems) > 0 && isStrings(elems[0])
+	}
+	return false
+}
+
+// where(x, pred) returns the paths of the leaf values under x for which
+// pred is true. C strings are given to pred as strings, without trailing
+// blanks, and values for which it fails, eg comparing a string to a number,
+// are skipped.
+func where(terp *interpreter, args []ast.Expr) reflect.Value {
+	if len(args) != 2 {
+		panic("where takes two arguments")
+	}
+	x := terp.eval(args[0])
+	pred := deref(terp.eval(args[1]))
+	if pred.Kind() != reflect.Func {
+		panic("where: predicate is not a function")
+	}
+
+	holds := func(v reflect.Value) (ok bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				panicError(r) // only the interpreter's errors are skipped
+				ok = false
+			}
+		}()
+		return truth(call(pred, []reflect.Value{cstrOperand(deref(v))}))
+	}
+
+	paths := []string{}
+	if isLeaf(x) && holds(x) {
+		paths = append(paths, "")
+	}
+	visitPaths(x, terp.Tag, "", func(at, name string, v reflect.Value) {
+		if isLeaf(v) && holds(v) {
+			paths = append(paths, at)
+		}
+	})
+	return reflect.ValueOf(paths)
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestFind(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `find(fs, "tsys")`, want: `["bbc[0].tsys","bbc[1].tsys","bbc[2].tsys","bbc[3].tsys"]`},
+		{src: `find(fs, "r*")`, want: `["equip.rack"]`},
+		{src: `find(fs, "/^(lsorna|iclbox)$/")`, want: `["lsorna","iclbox"]`},
+		{src: `find(fs.bbc[1], "*")`, want: `["freq","bw","name","tsys"]`},
+		{src: `find(fs, "nothing")`, want: `[]`},
+		{src: `find(fs, "[")`, err: "bad pattern"},
+		{src: `find(fs)`, err: "find takes two arguments"},
+		{src: `submatch("3C84", "^([0-9])C")`, want: `["3C","3"]`},
+		{src: `submatch(fs.bbc.name, "^[a-c]")`, want: `[["a"],["b"],null,null]`},
+	})
+}
+
+func TestWhere(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `where(fs, func(x) { return x == "3C84" })`, want: `["lsorna","bbc[2].name"]`},
+		{src: `where(fs.bbc, isnan)`, want: `["[3].tsys"]`},
+		{src: `where(fs.bbc, func(x) { return x > 250 })`, want: `["[2].freq","[3].freq"]`},
+		{src: `where(fs.bbc[0].freq, func(x) { return x == 100 })`, want: `[""]`},
+		{src: `where(fs, 1)`, err: "where: predicate is not a function"},
+	})
+}
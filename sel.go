@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var selBuiltins = []builtin{
+	{"sel", special(sel), "sel(x, pattern)", "values in x at paths matching pattern, eg \"bbc[*].freq\" or \"**.tsys\", by path"},
+}
+
+// A selStep is a step of a sel pattern: a field or key name glob, an index
+// glob in brackets, or ** for any number of steps
+type selStep struct {
+	glob  string
+	index bool
+}
+
+// parseSel splits pattern into steps
+func parseSel(pattern string) []selStep {
+	var steps []selStep
+	for _, part := range strings.Split(pattern, ".") {
+		name := part
+		if i := strings.IndexByte(part, '['); i != -1 {
+			name = part[:i]
+		}
+		if name != "" {
+			steps = append(steps, selStep{glob: name})
+		}
+
+		rest := part[len(name):]
+		for rest != "" {
+			end := strings.IndexByte(rest, ']')
+			if rest[0] != '[' || end == -1 {
+				panic(fmt.Errorf("bad pattern %q", pattern))
+			}
+			steps = append(steps, selStep{glob: rest[1:end], index: true})
+			rest = rest[end+1:]
+		}
+		if name == "" && part == "" {
+			panic(fmt.Errorf("bad pattern %q", pattern))
+		}
+	}
+	return steps
+}
+
+// globMatch reports if name matches glob, panicking on bad globs
+func globMatch(glob, name string) bool {
+	ok, err := path.Match(glob, name)
+	if err != nil {
+		panic(fmt.Errorf("bad pattern %q: %s", glob, err))
+	}
+	return ok
+}
+
+// selChild is a named child of a value
+type selChild struct {
+	path string
+	v    reflect.Value
+}
+
+// fieldName is the name of field i of struct type t as the interpreter
+// selects it with the struct tag key tag: its tag name, or else its Go
+// name. It is false if the field can't be selected by that name.
+func fieldName(t reflect.Type, tag string, i int) (string, bool) {
+	field := t.Field(i)
+	if field.PkgPath != "" {
+		return "", false
+	}
+	name := field.Name
+	if tag != "" {
+		if s, ok := tagName(field, tag); ok && s != "" {
+			name = s
+		}
+	}
+	if name == "-" {
+		return "", false
+	}
+	f, ok := structField(t, tag, name)
+	return name, ok && len(f.Index) == 1 && f.Index[0] == i
+}
+
+// selChildren returns the fields, elements or entries of v whose names
+// match glob, with their paths below at. Fields are named as by the
+// interpreter with the struct tag key tag, and fields of the elements of
+// arrays are found by name.
+func selChildren(v reflect.Value, tag, at string, step selStep) []selChild {
+	var out []selChild
+	join := func(name string) string {
+		if at == "" {
+			return name
+		}
+		return at + "." + name
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if step.index {
+			break
+		}
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := fieldName(v.Type(), tag, i)
+			if ok && globMatch(step.glob, name) {
+				out = append(out, selChild{join(name), v.Field(i)})
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		if isCString(v.Type()) {
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			p := at + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case step.index && globMatch(step.glob, strconv.Itoa(i)):
+				out = append(out, selChild{p, v.Index(i)})
+			case !step.index:
+				out = append(out, selChildren(deref(v.Index(i)), tag, p, step)...)
+			}
+		}
+	case reflect.Map:
+		for _, key := range sortedKeys(v) {
+			k := fmt.Sprint(key)
+			if !globMatch(step.glob, k) {
+				continue
+			}
+			if step.index {
+				out = append(out, selChild{at + "[" + strconv.Quote(k) + "]", v.MapIndex(key)})
+			} else {
+				out = append(out, selChild{join(k), v.MapIndex(key)})
+			}
+		}
+	}
+	return out
+}
+
+// deref follows pointers and interfaces, returning the zero Value for nil
+func deref(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// plain is v as an interface, with C strings as strings, for results that
+// copy values out of shared memory
+func plain(v reflect.Value) interface{} {
+	if isCString(v.Type()) {
+		return cstr(v.Interface())
+	}
+	return v.Interface()
+}
+
+// selMatch adds the values under v matching steps to out, by path
+func selMatch(v reflect.Value, tag, at string, steps []selStep, out map[string]interface{}) {
+	v = deref(v)
+	if !v.IsValid() {
+		return
+	}
+	if len(steps) == 0 {
+		out[at] = plain(v)
+		return
+	}
+
+	step := steps[0]
+	if !step.index && step.glob == "**" {
+		selMatch(v, tag, at, steps[1:], out)
+		all := selStep{glob: "*", index: v.Kind() == reflect.Array || v.Kind() == reflect.Slice}
+		for _, c := range selChildren(v, tag, at, all) {
+			selMatch(c.v, tag, c.path, steps, out)
+		}
+		return
+	}
+
+	for _, c := range selChildren(v, tag, at, step) {
+		selMatch(c.v, tag, c.path, steps[1:], out)
+	}
+}
+
+// sel(x, pattern) returns the values in x at the paths matching pattern.
+// Steps of the pattern are separated by dots, and are globs of field names,
+// as selected by the interpreter, or of indices in brackets. ** matches any
+// number of steps, and names match the fields of each element of an array.
+func sel(terp *interpreter, args []ast.Expr) reflect.Value {
+	if len(args) != 2 {
+		panic("sel takes two arguments")
+	}
+	x := terp.eval(args[0])
+	pattern := text(terp.eval(args[1]))
+
+	out := map[string]interface{}{}
+	selMatch(x, terp.Tag, "", parseSel(pattern), out)
+	return reflect.ValueOf(out)
+}
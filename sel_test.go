@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSel(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{src: `sel(fs, "bbc[*].freq")`, want: `{"bbc[0].freq":100,"bbc[1].freq":200,"bbc[2].freq":300,"bbc[3].freq":400}`},
+		{src: `sel(fs, "bbc[1:2].freq")`, want: `{}`},
+		{src: `sel(fs, "bbc[1].bw[0]")`, want: `{"bbc[1].bw[0]":4}`},
+		{src: `sel(fs.bbc, "name")`, want: `{"[0].name":"a   ","[1].name":"b   ","[2].name":"3C84","[3].name":"d   "}`},
+		{src: `sel(fs, "bbc[*].name")`, want: `{"bbc[0].name":"a   ","bbc[1].name":"b   ","bbc[2].name":"3C84","bbc[3].name":"d   "}`},
+		{src: `sel(fs, "lsorna")`, want: `{"lsorna":"3C84      "}`},
+		{src: `sel(fs, "**.rack")`, want: `{"equip.rack":4}`},
+		{src: `sel(fs, "e*")`, want: `{"equip":{"rack":4}}`},
+		{src: `sel(fs, "bbc[0]")`, want: `{"bbc[0]":{"freq":100,"bw":[4,8],"name":"a   ","tsys":0}}`},
+		{src: `sel(fs, "bbc.")`, err: "bad pattern"},
+	})
+}
+
+// badJSON panics when it is encoded
+type badJSON struct{}
+
+func (badJSON) MarshalJSON() ([]byte, error) {
+	panic("bad value")
+}
+
+func TestDisplayRecovers(t *testing.T) {
+	var buf bytes.Buffer
+	display(&buf, "json", "x", reflect.ValueOf(badJSON{}))
+	if got := buf.String(); !strings.HasPrefix(got, "error: can't encode x: bad value") {
+		t.Errorf("display of a value that panics: got %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// A statement is the source of a statement, and the line it starts on
+type statement struct {
+	src  string
+	line int
+}
+
+// A scanError is an error scanning the source of statements
+type scanError struct {
+	pos token.Position
+	msg string
+}
+
+func (e *scanError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.pos.Line, e.pos.Column, e.msg)
+}
+
+// statements splits src into statements at semicolons and newlines that are
+// outside brackets and strings, as Go would. complete is false if src ends
+// part way through a statement: inside brackets, a raw string or a comment,
+// or after an operator. err is the first error scanning src, such as an
+// unterminated interpreted string, which can't continue onto another line.
+// The statements are still split, as far as they can be.
+func statements(src string) (stmts []statement, complete bool, err error) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+
+	unterminated := false
+	var s scanner.Scanner
+	s.Init(file, []byte(src), func(pos token.Position, msg string) {
+		switch msg {
+		case "raw string literal not terminated", "comment not terminated":
+			unterminated = true
+		default:
+			if err == nil {
+				err = &scanError{pos, msg}
+			}
+		}
+	}, 0)
+
+	depth, start := 0, -1
+	var last token.Token
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		off := file.Offset(pos)
+
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.SEMICOLON:
+			if depth > 0 {
+				break
+			}
+			if start != -1 {
+				stmts = append(stmts, statement{strings.TrimSpace(src[start:off]), file.Line(file.Pos(start))})
+				start = -1
+			}
+			last = tok
+			continue
+		}
+
+		if start == -1 {
+			start = off
+		}
+		last = tok
+	}
+	if start != -1 {
+		stmts = append(stmts, statement{strings.TrimSpace(src[start:]), file.Line(file.Pos(start))})
+	}
+
+	complete = depth <= 0 && !unterminated && !continues(last)
+	return stmts, complete, err
+}
+
+// continues reports if a statement can't end with tok
+func continues(tok token.Token) bool {
+	switch tok {
+	case token.PERIOD, token.COMMA, token.ASSIGN, token.DEFINE, token.NOT, token.COLON:
+		return true
+	}
+	return tok.Precedence() > 0
+}
+
+// oneLine joins the lines of src, so it can be kept in the history.
+// Newlines that end statements become semicolons and comments are dropped.
+// src must scan without errors, as checked by statements, or its strings may
+// be changed.
+func oneLine(src string) string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+
+	var b strings.Builder
+	prev, space := 0, false
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		off := file.Offset(pos)
+		if off > prev {
+			space = true
+		}
+
+		text := lit
+		switch {
+		case tok == token.SEMICOLON && lit == "\n":
+			b.WriteByte(';')
+			continue
+		case tok == token.COMMENT:
+			prev = off + len(lit)
+			continue
+		case lit == "":
+			text = tok.String()
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(text)
+		prev = off + len(text)
+	}
+	return strings.TrimRight(b.String(), "; ")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		src      string
+		want     []statement
+		complete bool
+		err      string
+	}{
+		{"", nil, true, ""},
+		{"fs.lsorna", []statement{{"fs.lsorna", 1}}, true, ""},
+		{"a = 1; b = 2", []statement{{"a = 1", 1}, {"b = 2", 1}}, true, ""},
+		{"a = 1\n\nb = 2\n", []statement{{"a = 1", 1}, {"b = 2", 3}}, true, ""},
+		{"f = func(x) {\n\treturn x * 2\n}", []statement{{"f = func(x) {\n\treturn x * 2\n}", 1}}, true, ""},
+		{"max(1,\n2)", []statement{{"max(1,\n2)", 1}}, true, ""},
+		{"a; ;; b", []statement{{"a", 1}, {"b", 1}}, true, ""},
+		{"a // comment\nb", []statement{{"a // comment", 1}, {"b", 2}}, true, ""},
+
+		{"max(1,", []statement{{"max(1,", 1}}, false, ""},
+		{"f = func(x) {", []statement{{"f = func(x) {", 1}}, false, ""},
+		{"a = 1 +", []statement{{"a = 1 +", 1}}, false, ""},
+		{"a =", []statement{{"a =", 1}}, false, ""},
+		{"fs.", []statement{{"fs.", 1}}, false, ""},
+		{"!", []statement{{"!", 1}}, false, ""},
+		{"a = `x", []statement{{"a = `x", 1}}, false, ""},
+		{"a /* x", []statement{{"a /* x", 1}}, false, ""},
+
+		{"a = 1\nb = \"x", []statement{{"a = 1", 1}, {"b = \"x", 2}}, true, "2:5: string literal not terminated"},
+	}
+	for _, tt := range tests {
+		stmts, complete, err := statements(tt.src)
+		if !reflect.DeepEqual(stmts, tt.want) || complete != tt.complete {
+			t.Errorf("statements(%q) = %q, %v, want %q, %v", tt.src, stmts, complete, tt.want, tt.complete)
+		}
+		switch {
+		case err == nil && tt.err != "":
+			t.Errorf("statements(%q): no error, want %q", tt.src, tt.err)
+		case err != nil && err.Error() != tt.err:
+			t.Errorf("statements(%q): error %q, want %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestOneLine(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"fs.lsorna", "fs.lsorna"},
+		{"a = 1\nb = 2\n", "a = 1; b = 2"},
+		{"f = func(x) {\n\treturn x * 2\n}", "f = func(x) { return x * 2; }"},
+		{"max(1,\n  2)", "max(1, 2)"},
+		{"a // comment\nb", "a; b"},
+		{"a /* x */ + b", "a + b"},
+		{"s = \"a  b\"\n", `s = "a  b"`},
+		{"r = `a\nb`", "r = `a\nb`"},
+	}
+	for _, tt := range tests {
+		if got := oneLine(tt.src); got != tt.want {
+			t.Errorf("oneLine(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var stringBuiltins = []builtin{
+	{"sprintf", sprintf, "sprintf(format, x...)", "x formatted with Go's fmt verbs"},
+	{"printf", printf, "printf(format, x...)", "print x formatted with Go's fmt verbs"},
+	{"upper", upper, "upper(s)", "s in upper case"},
+	{"lower", lower, "lower(s)", "s in lower case"},
+	{"trim", trim, "trim(s[, cutset])", "s without leading and trailing white space, or characters in cutset"},
+	{"split", split, "split(s, sep)", "the substrings of s separated by sep"},
+	{"join", join, "join(strs, sep)", "the strings in strs separated by sep"},
+	{"contains", contains, "contains(s, substr)", "whether substr is in s"},
+	{"hasprefix", hasprefix, "hasprefix(s, prefix)", "whether s begins with prefix"},
+	{"replace", replace, "replace(s, old, new)", "s with each old replaced by new"},
+	{"match", match, "match(s, regexp)", "whether s matches regexp"},
+	{"submatch", submatch, "submatch(s, regexp)", "the first match of regexp in s and its submatches"},
+}
+
+// The string builtins take strings or C strings, and the ones of a single
+// string apply to each element of arrays of them.
+
+// text returns the string or C string v
+func text(v reflect.Value) string {
+	if !v.IsValid() {
+		panic("nil is not a string")
+	}
+	v = constDemote(v)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			panic("nil is not a string")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String && !isCString(v.Type()) {
+		panic(fmt.Errorf("%s is not a string", v.Type()))
+	}
+	return cstr(v.Interface())
+}
+
+// stringwise applies f to the string x, or each string in x
+func stringwise(x reflect.Value, f func(string) interface{}) interface{} {
+	elems, ok := elements(x)
+	if !ok {
+		return f(text(x))
+	}
+	out := make([]interface{}, len(elems))
+	for i, e := range elems {
+		out[i] = stringwise(e, f)
+	}
+	return out
+}
+
+// stringFunc makes a builtin applying f to a string, or each in an array,
+// with the other arguments as strings
+func stringFunc(f func(s string, args ...string) interface{}) func(x interface{}, args ...interface{}) interface{} {
+	return func(x interface{}, args ...interface{}) interface{} {
+		strs := make([]string, len(args))
+		for i, a := range args {
+			strs[i] = text(reflect.ValueOf(a))
+		}
+		return stringwise(reflect.ValueOf(x), func(s string) interface{} {
+			return f(s, strs...)
+		})
+	}
+}
+
+// nargs panics unless args has between min and max elements
+func nargs(name string, args []string, min, max int) {
+	if len(args) < min || len(args) > max {
+		panic(fmt.Errorf("wrong number of arguments to %s", name))
+	}
+}
+
+// fmtArgs dereferences pointers to fields in args, and converts C strings
+// to strings, for fmt
+func fmtArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, a := range args {
+		v := reflect.ValueOf(a)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		switch {
+		case !v.IsValid():
+			out[i] = a
+		case isCString(v.Type()):
+			out[i] = cstr(v.Interface())
+		default:
+			out[i] = v.Interface()
+		}
+	}
+	return out
+}
+
+func sprintf(format interface{}, args ...interface{}) string {
+	return fmt.Sprintf(text(reflect.ValueOf(format)), fmtArgs(args)...)
+}
+
+func printf(format interface{}, args ...interface{}) {
+	fmt.Printf(text(reflect.ValueOf(format)), fmtArgs(args)...)
+}
+
+var (
+	upper = stringFunc(func(s string, args ...string) interface{} {
+		nargs("upper", args, 0, 0)
+		return strings.ToUpper(s)
+	})
+	lower = stringFunc(func(s string, args ...string) interface{} {
+		nargs("lower", args, 0, 0)
+		return strings.ToLower(s)
+	})
+	trim = stringFunc(func(s string, args ...string) interface{} {
+		nargs("trim", args, 0, 1)
+		if len(args) == 1 {
+			return strings.Trim(s, args[0])
+		}
+		return strings.TrimSpace(s)
+	})
+	split = stringFunc(func(s string, args ...string) interface{} {
+		nargs("split", args, 1, 1)
+		return strings.Split(s, args[0])
+	})
+	contains = stringFunc(func(s string, args ...string) interface{} {
+		nargs("contains", args, 1, 1)
+		return strings.Contains(s, args[0])
+	})
+	hasprefix = stringFunc(func(s string, args ...string) interface{} {
+		nargs("hasprefix", args, 1, 1)
+		return strings.HasPrefix(s, args[0])
+	})
+	replace = stringFunc(func(s string, args ...string) interface{} {
+		nargs("replace", args, 2, 2)
+		return strings.ReplaceAll(s, args[0], args[1])
+	})
+)
+
+// join joins the strings or C strings in strs
+func join(strs interface{}, sep interface{}) string {
+	elems, ok := elements(reflect.ValueOf(strs))
+	if !ok {
+		panic("join of a non-array")
+	}
+	parts := make([]string, len(elems))
+	for i, e := range elems {
+		parts[i] = text(e)
+	}
+	return strings.Join(parts, text(reflect.ValueOf(sep)))
+}
+
+func match(x interface{}, re interface{}) interface{} {
+	r := regexp.MustCompile(text(reflect.ValueOf(re)))
+	return stringwise(reflect.ValueOf(x), func(s string) interface{} {
+		return r.MatchString(s)
+	})
+}
+
+func submatch(x interface{}, re interface{}) interface{} {
+	r := regexp.MustCompile(text(reflect.ValueOf(re)))
+	return stringwise(reflect.ValueOf(x), func(s string) interface{} {
+		return r.FindStringSubmatch(s)
+	})
+}
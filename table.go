@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tabulate splits v into rows, one for each element of an array or slice
+// and otherwise just v, and the rows into cells by the json paths of their
+// leaves. Columns are in the order they are first found. A scalar row has
+// one column, named after label.
+func tabulate(label string, v reflect.Value) (columns []string, rows []map[string]string) {
+	v = deref(v)
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	elems := []reflect.Value{v}
+	if (v.Kind() == reflect.Array || v.Kind() == reflect.Slice) && !isCString(v.Type()) {
+		elems = make([]reflect.Value, v.Len())
+		for i := range elems {
+			elems[i] = v.Index(i)
+		}
+	}
+
+	root := labelPath(label)
+	seen := map[string]bool{}
+	for _, e := range elems {
+		row := map[string]string{}
+		walk(e, "json", nil, func(path []string, v reflect.Value) {
+			name := strings.Join(path, ".")
+			if name == "" {
+				name = labelName(label)
+			}
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+			row[name] = cell(v, fieldOf(root, path))
+		})
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+// fieldOf is the json path without indices of the leaf at path under the
+// field at root
+func fieldOf(root, path []string) []string {
+	p := root[:len(root):len(root)]
+	for _, name := range path {
+		if _, err := strconv.Atoi(name); err != nil {
+			p = append(p, name)
+		}
+	}
+	return p
+}
+
+// cell is the text of the leaf v, at the json path without indices path, in
+// a table. Integers are formatted as for JSON output, in hex if hexInts is
+// set, and with enum names if showEnums is.
+func cell(v reflect.Value, path []string) string {
+	if v.CanInterface() {
+		v = constDemote(v)
+	}
+	switch {
+	case isCString(v.Type()):
+		return strings.TrimRight(cstr(v.Interface()), " ")
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano)
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.String:
+		return v.String()
+	}
+	if isInt(v) {
+		return fmt.Sprint(truncatePath(v, 0, path))
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// encodeTable writes v as a table with aligned columns and a header
+func encodeTable(w io.Writer, label string, v reflect.Value) error {
+	columns, rows := tabulate(label, v)
+	if len(columns) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			cells[i] = row[c]
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// encodeCSV writes v as CSV, with a header
+func encodeCSV(w io.Writer, label string, v reflect.Value) error {
+	columns, rows := tabulate(label, v)
+	if len(columns) == 0 {
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			cells[i] = row[c]
+		}
+		cw.Write(cells)
+	}
+	cw.Flush()
+	return cw.Error()
+}